@@ -1,13 +1,66 @@
 package config
 
+import "time"
+
 // set config properties by env variables. env-default is only for development
 type Properties struct {
-	Port            string `env:"MY_APP_PORT" env-default:"1323"`
-	Host            string `env:"HOST" env-default:"localhost"`
-	DBHost          string `env:"DB_HOST" env-default:"localhost"`
-	DBPort          string `env:"DB_PORT" env-default:"27017"`
-	DBName          string `env:"DB_NAME" env-default:"blog"`
-	PostsCollection string `env:"PRODUCTS_COLLECTION" env-default:"posts"`
-	UsersCollection string `env:"USERS_COLLECTION" env-default:"users"`
-	JwtTokenSecret  string `env:"JWT_SECRET" env-default:"abrakadabra"`
+	Port                    string        `env:"MY_APP_PORT" env-default:"1323"`
+	Host                    string        `env:"HOST" env-default:"localhost"`
+	AppURL                  string        `env:"APP_URL" env-default:"http://localhost:1323"`
+	DBHost                  string        `env:"DB_HOST" env-default:"localhost"`
+	DBPort                  string        `env:"DB_PORT" env-default:"27017"`
+	DBName                  string        `env:"DB_NAME" env-default:"blog"`
+	PostsCollection         string        `env:"PRODUCTS_COLLECTION" env-default:"posts"`
+	UsersCollection         string        `env:"USERS_COLLECTION" env-default:"users"`
+	SessionsCollection      string        `env:"SESSIONS_COLLECTION" env-default:"sessions"`
+	ResetsCollection        string        `env:"RESETS_COLLECTION" env-default:"password_resets"`
+	VerificationsCollection string        `env:"VERIFICATIONS_COLLECTION" env-default:"email_verifications"`
+	TokensCollection        string        `env:"TOKENS_COLLECTION" env-default:"access_tokens"`
+	ThrottlesCollection     string        `env:"THROTTLES_COLLECTION" env-default:"login_throttles"`
+	AttemptsCollection      string        `env:"ATTEMPTS_COLLECTION" env-default:"login_attempts"`
+	RevisionsCollection     string        `env:"REVISIONS_COLLECTION" env-default:"post_revisions"`
+	TimelinesCollection     string        `env:"TIMELINES_COLLECTION" env-default:"timelines"`
+	ActivityCollection      string        `env:"ACTIVITY_COLLECTION" env-default:"post_activity"`
+	TrendsCollection        string        `env:"TRENDS_COLLECTION" env-default:"trends"`
+	AuditCollection         string        `env:"AUDIT_COLLECTION" env-default:"audit_log"`
+	JwtKeysDir              string        `env:"JWT_KEYS_DIR" env-default:"jwt-keys"`
+	JwtEphemeralKey         bool          `env:"JWT_EPHEMERAL_KEY" env-default:"false"`
+	JwtSigningKeyID         string        `env:"JWT_SIGNING_KEY_ID"`
+	AccessTokenTTL          time.Duration `env:"ACCESS_TOKEN_TTL" env-default:"15m"`
+	RefreshTokenTTL         time.Duration `env:"REFRESH_TOKEN_TTL" env-default:"720h"`
+	ChallengeTokenTTL       time.Duration `env:"CHALLENGE_TOKEN_TTL" env-default:"5m"`
+	TOTPIssuer              string        `env:"TOTP_ISSUER" env-default:"Blogpost"`
+	PasswordResetURL        string        `env:"PASSWORD_RESET_URL"`
+	PasswordResetTTL        time.Duration `env:"PASSWORD_RESET_TTL" env-default:"1h"`
+	VerificationTTL         time.Duration `env:"VERIFICATION_TTL" env-default:"48h"`
+	VerificationResendWait  time.Duration `env:"VERIFICATION_RESEND_WAIT" env-default:"5m"`
+	TrustedProxies          []string      `env:"TRUSTED_PROXIES"`
+	LoginAccountThreshold   int           `env:"LOGIN_ACCOUNT_THRESHOLD" env-default:"5"`
+	LoginIPThreshold        int           `env:"LOGIN_IP_THRESHOLD" env-default:"50"`
+	LoginBackoffBase        time.Duration `env:"LOGIN_BACKOFF_BASE" env-default:"1s"`
+	LoginMaxBackoff         time.Duration `env:"LOGIN_MAX_BACKOFF" env-default:"1m"`
+	LoginLockout            time.Duration `env:"LOGIN_LOCKOUT" env-default:"15m"`
+	LoginMaxLockout         time.Duration `env:"LOGIN_MAX_LOCKOUT" env-default:"24h"`
+	LoginFailureWindow      time.Duration `env:"LOGIN_FAILURE_WINDOW" env-default:"1h"`
+	LoginAttemptsRetention  time.Duration `env:"LOGIN_ATTEMPTS_RETENTION" env-default:"720h"`
+	AccountDeletionGrace    time.Duration `env:"ACCOUNT_DELETION_GRACE" env-default:"720h"`
+	AccountDeletionInterval time.Duration `env:"ACCOUNT_DELETION_INTERVAL" env-default:"1m"`
+	TrashRetention          time.Duration `env:"TRASH_RETENTION" env-default:"720h"`
+	PurgeInterval           time.Duration `env:"PURGE_INTERVAL" env-default:"1h"`
+	PublishInterval         time.Duration `env:"PUBLISH_INTERVAL" env-default:"30s"`
+	FanoutInterval          time.Duration `env:"FANOUT_INTERVAL" env-default:"5s"`
+	FanoutMaxFollowers      int           `env:"FANOUT_MAX_FOLLOWERS" env-default:"10000"`
+	TimelineBackfillPosts   int           `env:"TIMELINE_BACKFILL_POSTS" env-default:"50"`
+	RankedFeedPool          int           `env:"RANKED_FEED_POOL" env-default:"500"`
+	HotRankingVariants      []string      `env:"HOT_RANKING_VARIANTS" env-default:"hot"`
+	TrendingInterval        time.Duration `env:"TRENDING_INTERVAL" env-default:"5m"`
+	TrendingSize            int           `env:"TRENDING_SIZE" env-default:"100"`
+	RequireVerifiedEmail    bool          `env:"REQUIRE_VERIFIED_EMAIL" env-default:"false"`
+	MailDriver              string        `env:"MAIL_DRIVER" env-default:"file"`
+	MailFrom                string        `env:"MAIL_FROM" env-default:"no-reply@blog.local"`
+	MailDir                 string        `env:"MAIL_DIR" env-default:"mails"`
+	SMTPHost                string        `env:"SMTP_HOST" env-default:"localhost"`
+	SMTPPort                string        `env:"SMTP_PORT" env-default:"25"`
+	SMTPUsername            string        `env:"SMTP_USERNAME"`
+	SMTPPassword            string        `env:"SMTP_PASSWORD"`
 }
@@ -0,0 +1,30 @@
+package db
+
+import (
+	"contacts/models"
+	"context"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// indexes of the audit log collection
+var AuditIndexes = []mongo.IndexModel{
+	{Keys: bson.D{{Key: "actor_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	{Keys: bson.M{"created_at": -1}},
+}
+
+// insert the entry in the audit log
+func RecordAudit(ctx context.Context, entry models.AuditEntry, collection CollectionAPI) *echo.HTTPError {
+	entry.ID = primitive.NewObjectID()
+	entry.CreatedAt = time.Now()
+
+	if _, err := collection.InsertOne(ctx, entry); err != nil {
+		return echo.NewHTTPError(500, "Unable to record audit entry")
+	}
+
+	return nil
+}
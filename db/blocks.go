@@ -0,0 +1,161 @@
+package db
+
+import (
+	"contacts/models"
+	"context"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Block or unblock toID for the requesting user fromID. Blocking removes the follows
+// between both users and the pending follow request of the blocked user
+func ToggleBlock(ctx context.Context, fromID, toID string, collection CollectionAPI) (bool, *echo.HTTPError) {
+	blocked, httpErr := toggleUserList(ctx, "blocked", fromID, toID, collection)
+	if httpErr != nil || !blocked {
+		return blocked, httpErr
+	}
+
+	fromDocID, _ := primitive.ObjectIDFromHex(fromID)
+	toDocID, _ := primitive.ObjectIDFromHex(toID)
+
+	if httpErr = removeFollow(ctx, fromDocID, toDocID, collection); httpErr != nil {
+		return blocked, httpErr
+	}
+
+	if httpErr = removeFollow(ctx, toDocID, fromDocID, collection); httpErr != nil {
+		return blocked, httpErr
+	}
+
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": fromDocID}, bson.M{"$pull": bson.M{"follow_requests": toID}})
+	if err != nil {
+		return blocked, echo.NewHTTPError(500, "Unable to update user")
+	}
+
+	return blocked, nil
+}
+
+// Mute or unmute toID for the requesting user fromID. Muted users are left out of the feed
+func ToggleMute(ctx context.Context, fromID, toID string, collection CollectionAPI) (bool, *echo.HTTPError) {
+	return toggleUserList(ctx, "muted", fromID, toID, collection)
+}
+
+// add toID to the list field of fromID or remove it if already there. Return whether it was added
+func toggleUserList(ctx context.Context, field, fromID, toID string, collection CollectionAPI) (bool, *echo.HTTPError) {
+	if fromID == toID {
+		return false, echo.NewHTTPError(400, "You can not do this to yourself")
+	}
+
+	userFrom, httpErr := FindUser(ctx, fromID, collection)
+	if httpErr != nil {
+		return false, httpErr
+	}
+
+	if _, httpErr = FindUser(ctx, toID, collection); httpErr != nil {
+		return false, httpErr
+	}
+
+	list := userFrom.Blocked
+	if field == "muted" {
+		list = userFrom.Muted
+	}
+
+	op := "$addToSet"
+	if contains(list, toID) {
+		op = "$pull"
+	}
+
+	if _, err := collection.UpdateOne(ctx, bson.M{"_id": userFrom.ID}, bson.M{op: bson.M{field: toID}}); err != nil {
+		return false, echo.NewHTTPError(500, "Unable to update user")
+	}
+
+	return op == "$addToSet", nil
+}
+
+// Retrieve a page of the public profiles of the users blocked by the user
+func GetBlockedUsers(ctx context.Context, id string, query models.PageQuery, collection CollectionAPI) ([]models.PublicProfile, string, *echo.HTTPError) {
+	user, httpErr := FindUser(ctx, id, collection)
+	if httpErr != nil {
+		return nil, "", httpErr
+	}
+
+	return findProfiles(ctx, user.Blocked, query, collection)
+}
+
+// Retrieve a page of the public profiles of the users muted by the user
+func GetMutedUsers(ctx context.Context, id string, query models.PageQuery, collection CollectionAPI) ([]models.PublicProfile, string, *echo.HTTPError) {
+	user, httpErr := FindUser(ctx, id, collection)
+	if httpErr != nil {
+		return nil, "", httpErr
+	}
+
+	return findProfiles(ctx, user.Muted, query, collection)
+}
+
+// Retrieve the ids of the users that blocked the viewer
+func blockedByIDs(ctx context.Context, viewerID string, collection CollectionAPI) ([]string, *echo.HTTPError) {
+	var users []models.User
+
+	opts := options.Find().SetProjection(bson.M{"_id": 1})
+	cursor, err := collection.Find(ctx, bson.M{"blocked": viewerID}, opts)
+	if err != nil {
+		return nil, echo.NewHTTPError(404, "Unable to find users")
+	}
+
+	if err = cursor.All(ctx, &users); err != nil {
+		return nil, echo.NewHTTPError(500, "Unable to parse retrieved users")
+	}
+
+	ids := make([]string, len(users))
+	for i, user := range users {
+		ids[i] = user.ID.Hex()
+	}
+
+	return ids, nil
+}
+
+// Get the authors of the feed of the user: the followed users and itself,
+// without muted users nor users that blocked it
+func FeedAuthors(ctx context.Context, user models.User, collection CollectionAPI) ([]string, *echo.HTTPError) {
+	blockedBy, httpErr := blockedByIDs(ctx, user.ID.Hex(), collection)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+
+	authors := []string{user.ID.Hex()}
+	for _, id := range user.Following {
+		if !contains(user.Muted, id) && !contains(blockedBy, id) {
+			authors = append(authors, id)
+		}
+	}
+
+	return authors, nil
+}
+
+// retrieve a page of the public profiles of the given user ids, newest users first
+func findProfiles(ctx context.Context, ids []string, query models.PageQuery, collection CollectionAPI) ([]models.PublicProfile, string, *echo.HTTPError) {
+	var users []models.User
+
+	docIDs := make([]primitive.ObjectID, 0, len(ids))
+	for _, id := range ids {
+		docID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return nil, "", echo.NewHTTPError(500, "Unable to convert to object id")
+		}
+		docIDs = append(docIDs, docID)
+	}
+
+	next, httpErr := findPage(ctx, collection, bson.M{"_id": bson.M{"$in": docIDs}}, query, &users)
+	if httpErr != nil {
+		return nil, "", httpErr
+	}
+
+	profiles := make([]models.PublicProfile, len(users))
+	for i, user := range users {
+		profiles[i] = user.PublicProfile()
+	}
+
+	return profiles, next, nil
+}
@@ -3,10 +3,13 @@ package db
 import (
 	"contacts/models"
 	"context"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // Handle comments creation in the db
@@ -16,29 +19,32 @@ func CreateComment(ctx context.Context, id string, comment models.Comment, colle
 	if err != nil {
 		return post, echo.NewHTTPError(400, "Unable to convert to object id")
 	}
-	filter := bson.M{"_id": docID}
-
-	result := collection.FindOne(ctx, filter)
-	if err = result.Decode(&post); err != nil {
-		return post, echo.NewHTTPError(422, "Unable to parse retrieved post")
-	}
-
 	comment.ID = primitive.NewObjectID()
-	post.Comments = append(post.Comments, comment)
+	comment.DeletedAt, comment.DeletedBy = nil, ""
 
-	res, err := collection.UpdateOne(ctx, filter, bson.M{"$set": post})
+	// posts created without comments store null, it can not be pushed to
+	_, err = collection.UpdateOne(ctx, bson.M{"_id": docID, "comments": nil}, bson.M{"$set": bson.M{"comments": bson.A{}}})
 	if err != nil {
-		return post, echo.NewHTTPError(500, "Unable to find posts")
+		return post, echo.NewHTTPError(500, "Unable to add comment")
 	}
-	if res.ModifiedCount == 0 || res.MatchedCount == 0 {
+
+	// the returned post is the one right after the push, the new comment is the last one
+	update := bson.M{"$push": bson.M{"comments": comment}}
+	result := collection.FindOneAndUpdate(ctx, bson.M{"_id": docID}, update, options.FindOneAndUpdate().SetReturnDocument(options.After))
+	err = result.Decode(&post)
+	if err == mongo.ErrNoDocuments {
 		return post, echo.NewHTTPError(404, "Post does not exist")
 	}
 
+	if err != nil {
+		return post, echo.NewHTTPError(500, "Unable to add comment")
+	}
+
 	return post, nil
 }
 
-// Handle Delete comments from the db
-func RemoveComment(ctx context.Context, postID string, commentID string, collection CollectionAPI) (models.Post, *echo.HTTPError) {
+// Move the comment to the deleted comments of the post, it is removed for good once the retention is over
+func RemoveComment(ctx context.Context, postID, commentID, deletedBy string, collection CollectionAPI) (models.Post, *echo.HTTPError) {
 	var post models.Post
 
 	postDocID, err := primitive.ObjectIDFromHex(postID)
@@ -51,23 +57,37 @@ func RemoveComment(ctx context.Context, postID string, commentID string, collect
 		return post, echo.NewHTTPError(400, "Unable to converto to object id")
 	}
 
-	filter := bson.M{"_id": postDocID}
+	filter := bson.M{"_id": postDocID, "deleted_at": nil}
 	res := collection.FindOne(ctx, filter)
 	if err = res.Decode(&post); err != nil {
-		return post, echo.NewHTTPError(500, "Unable to decode retrieved post")
+		return post, echo.NewHTTPError(404, "Post not found")
 	}
 
 	for i, comment := range post.Comments {
-		if comment.ID == commetDocID {
-			post.Comments = append(post.Comments[:i], post.Comments[i+1:]...)
-			break
+		if comment.ID != commetDocID {
+			continue
 		}
-	}
 
-	_, err = collection.UpdateOne(ctx, filter, bson.M{"$set": post})
-	if err != nil {
-		return post, echo.NewHTTPError(500, "Unable to update the post")
+		now := time.Now()
+		comment.DeletedAt, comment.DeletedBy = &now, deletedBy
+		update := bson.M{
+			"$pull": bson.M{"comments": bson.M{"_id": commetDocID}},
+			"$push": bson.M{"deleted_comments": comment},
+		}
+
+		filter["comments._id"] = commetDocID
+		result, err := collection.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return post, echo.NewHTTPError(500, "Unable to update the post")
+		}
+
+		if result.ModifiedCount == 0 {
+			return post, echo.NewHTTPError(404, "Comment does not exist")
+		}
+
+		post.Comments = append(post.Comments[:i], post.Comments[i+1:]...)
+		return post, nil
 	}
 
-	return post, nil
+	return post, echo.NewHTTPError(404, "Comment does not exist")
 }
@@ -0,0 +1,183 @@
+package db
+
+import (
+	"contacts/models"
+	"context"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// DeletionCollections groups every collection holding data of the users
+type DeletionCollections struct {
+	Users         CollectionAPI
+	Posts         CollectionAPI
+	Sessions      CollectionAPI
+	Resets        CollectionAPI
+	Verifications CollectionAPI
+	Tokens        CollectionAPI
+	Revisions     CollectionAPI
+	Timelines     CollectionAPI
+	Activity      CollectionAPI
+}
+
+// a deletion step removes one kind of data of the user. Steps must be idempotent
+// so a deletion interrupted midway can run them again
+type deletionStep func(ctx context.Context, userID string, cols DeletionCollections) error
+
+// steps of the account deletion in order. The progress is stored in the user so an
+// interrupted deletion resumes from the last finished step
+var deletionSteps = []deletionStep{
+	// posts of the user
+	func(ctx context.Context, userID string, cols DeletionCollections) error {
+		_, err := cols.Posts.DeleteMany(ctx, bson.M{"from": userID})
+		return err
+	},
+	// comments of the user in other users posts, deleted ones included
+	func(ctx context.Context, userID string, cols DeletionCollections) error {
+		for _, field := range []string{"comments", "deleted_comments"} {
+			_, err := cols.Posts.UpdateMany(ctx, bson.M{field + ".from": userID}, bson.M{"$pull": bson.M{field: bson.M{"from": userID}}})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+	// likes of the user
+	func(ctx context.Context, userID string, cols DeletionCollections) error {
+		update := bson.M{"$pull": bson.M{"liked_by": userID}, "$inc": bson.M{"likes": -1}}
+		_, err := cols.Posts.UpdateMany(ctx, bson.M{"liked_by": userID}, update)
+		return err
+	},
+	// references in the follows, follow requests, blocks, mutes and dismissed suggestions of other users
+	func(ctx context.Context, userID string, cols DeletionCollections) error {
+		for _, field := range []string{"followers", "following", "follow_requests", "blocked", "muted", "dismissed_suggestions"} {
+			update := bson.M{"$pull": bson.M{field: userID}}
+			if field == "followers" {
+				update["$inc"] = bson.M{"followers_count": -1}
+			}
+
+			if _, err := cols.Users.UpdateMany(ctx, bson.M{field: userID}, update); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+	// sessions and tokens of the user
+	func(ctx context.Context, userID string, cols DeletionCollections) error {
+		for _, collection := range []CollectionAPI{cols.Sessions, cols.Resets, cols.Verifications, cols.Tokens} {
+			if _, err := collection.DeleteMany(ctx, bson.M{"user_id": userID}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+	// revisions of the posts edited by the user
+	func(ctx context.Context, userID string, cols DeletionCollections) error {
+		_, err := cols.Revisions.DeleteMany(ctx, bson.M{"author_id": userID})
+		return err
+	},
+	// timeline of the user and its posts delivered to other timelines
+	func(ctx context.Context, userID string, cols DeletionCollections) error {
+		_, err := cols.Timelines.DeleteMany(ctx, bson.M{"$or": bson.A{bson.M{"user_id": userID}, bson.M{"author_id": userID}}})
+		return err
+	},
+	// likes and comments of the user and on its posts kept for the trends
+	func(ctx context.Context, userID string, cols DeletionCollections) error {
+		_, err := cols.Activity.DeleteMany(ctx, bson.M{"$or": bson.A{bson.M{"user_id": userID}, bson.M{"author_id": userID}}})
+		return err
+	},
+}
+
+// Schedule the deletion of the user after the grace period, sign out every device and revoke
+// the personal access tokens.
+// Logging in before the deletion is due cancels it
+func ScheduleAccountDeletion(ctx context.Context, id, password string, cols DeletionCollections) (time.Time, *echo.HTTPError) {
+	user, httpErr := FindUser(ctx, id, cols.Users)
+	if httpErr != nil {
+		return time.Time{}, httpErr
+	}
+
+	if !isValidCredential(password, user.Password) {
+		return time.Time{}, echo.NewHTTPError(400, "Invalid credentials")
+	}
+
+	dueAt := time.Now().Add(cfg.AccountDeletionGrace)
+	if _, err := cols.Users.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"deletion_due_at": dueAt}}); err != nil {
+		return time.Time{}, echo.NewHTTPError(500, "Unable to schedule deletion")
+	}
+
+	if httpErr = RevokeUserSessions(ctx, id, cols.Sessions); httpErr != nil {
+		return time.Time{}, httpErr
+	}
+
+	if httpErr = RevokeUserAccessTokens(ctx, id, cols.Tokens); httpErr != nil {
+		return time.Time{}, httpErr
+	}
+
+	return dueAt, nil
+}
+
+// Cancel a scheduled deletion unless it already started
+func CancelAccountDeletion(ctx context.Context, user models.User, collection CollectionAPI) *echo.HTTPError {
+	filter := bson.M{"_id": user.ID, "deletion_step": bson.M{"$exists": false}, "deletion_lock": bson.M{"$exists": false}}
+	update := bson.M{"$unset": bson.M{"deletion_due_at": ""}}
+
+	res, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return echo.NewHTTPError(500, "Unable to cancel account deletion")
+	}
+
+	if res.MatchedCount == 0 {
+		return echo.NewHTTPError(403, "Account is being deleted")
+	}
+
+	return nil
+}
+
+// Claim one user whose deletion is due, or whose deletion was interrupted, locking it
+// for the given time so other instances leave it alone. Return false if there is none
+func ClaimDueDeletion(ctx context.Context, lock time.Duration, collection CollectionAPI) (models.User, bool, error) {
+	var user models.User
+
+	now := time.Now()
+	filter := bson.M{
+		"deletion_due_at": bson.M{"$lte": now},
+		"$or":             bson.A{bson.M{"deletion_lock": nil}, bson.M{"deletion_lock": bson.M{"$lt": now}}},
+	}
+
+	result := collection.FindOneAndUpdate(ctx, filter, bson.M{"$set": bson.M{"deletion_lock": now.Add(lock)}})
+	err := result.Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return user, false, nil
+	}
+
+	if err != nil {
+		return user, false, err
+	}
+
+	return user, true, nil
+}
+
+// Run the remaining deletion steps of the claimed user and remove it at the end
+func DeleteAccount(ctx context.Context, user models.User, cols DeletionCollections) error {
+	userID := user.ID.Hex()
+
+	for step := user.DeletionStep; step < len(deletionSteps); step++ {
+		if err := deletionSteps[step](ctx, userID, cols); err != nil {
+			return err
+		}
+
+		if _, err := cols.Users.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"deletion_step": step + 1}}); err != nil {
+			return err
+		}
+	}
+
+	_, err := cols.Users.DeleteOne(ctx, bson.M{"_id": user.ID})
+	return err
+}
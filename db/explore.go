@@ -0,0 +1,250 @@
+package db
+
+import (
+	"contacts/models"
+	"context"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// sliding windows of the trending posts and tags
+var trendWindows = map[string]time.Duration{
+	"1h":  time.Hour,
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+}
+
+// window used when none is requested
+const DefaultTrendWindow = "24h"
+
+// weights of the activity in the trending score
+const (
+	trendLikeWeight    = 1.0
+	trendCommentWeight = 2.0
+)
+
+// indexes of the activity collection. Activity older than the longest window expires,
+// likes and comments are removed when they are undone
+var ActivityIndexes = []mongo.IndexModel{
+	{Keys: bson.M{"created_at": 1}, Options: options.Index().SetExpireAfterSeconds(int32(trendWindows["7d"].Seconds()))},
+	{Keys: bson.D{{Key: "post_id", Value: 1}, {Key: "user_id", Value: 1}, {Key: "kind", Value: 1}}},
+	{Keys: bson.M{"comment_id": 1}, Options: options.Index().SetSparse(true)},
+	{Keys: bson.M{"user_id": 1}},
+	{Keys: bson.M{"author_id": 1}},
+}
+
+// Get a page of the recent posts anyone can see
+func GetExplore(ctx context.Context, query models.PageQuery, posts CollectionAPI) ([]models.Post, string, *echo.HTTPError) {
+	var explore []models.Post
+
+	next, httpErr := findPublishedPage(ctx, posts, publicFilter(), query, &explore)
+	return explore, next, httpErr
+}
+
+// Store the like or comment of a user for the trending posts and tags
+func RecordActivity(ctx context.Context, activity models.Activity, collection CollectionAPI) *echo.HTTPError {
+	if _, err := collection.InsertOne(ctx, activity); err != nil {
+		return echo.NewHTTPError(500, "Unable to record activity")
+	}
+
+	return nil
+}
+
+// Remove the like of the user on the post once it is undone
+func RemoveLikeActivity(ctx context.Context, postID, userID string, collection CollectionAPI) *echo.HTTPError {
+	filter := bson.M{"post_id": postID, "user_id": userID, "kind": models.ActivityLike}
+	if _, err := collection.DeleteMany(ctx, filter); err != nil {
+		return echo.NewHTTPError(500, "Unable to remove activity")
+	}
+
+	return nil
+}
+
+// Remove the activity on the post once it is trashed or unpublished, so it stops trending
+func RemovePostActivity(ctx context.Context, postID string, collection CollectionAPI) *echo.HTTPError {
+	if _, err := collection.DeleteMany(ctx, bson.M{"post_id": postID}); err != nil {
+		return echo.NewHTTPError(500, "Unable to remove activity")
+	}
+
+	return nil
+}
+
+// Remove the comment once it is deleted
+func RemoveCommentActivity(ctx context.Context, commentID string, collection CollectionAPI) *echo.HTTPError {
+	docID, err := primitive.ObjectIDFromHex(commentID)
+	if err != nil {
+		return echo.NewHTTPError(400, "Unable to convert to object id")
+	}
+
+	if _, err = collection.DeleteMany(ctx, bson.M{"comment_id": docID}); err != nil {
+		return echo.NewHTTPError(500, "Unable to remove activity")
+	}
+
+	return nil
+}
+
+// Compute the trending posts and tags of every window from the activity on posts of public users
+// and store them. Every run replaces the previous results, so many instances can run it
+func ComputeTrends(ctx context.Context, activity, trends CollectionAPI) error {
+	now := time.Now()
+	for name, window := range trendWindows {
+		match := bson.M{"created_at": bson.M{"$gte": now.Add(-window)}, "author_private": bson.M{"$ne": true}}
+
+		for kind, groupBy := range map[string]string{"posts": "$post_id", "tags": "$tags"} {
+			pipeline := []bson.M{{"$match": match}}
+			if kind == "tags" {
+				pipeline = append(pipeline, bson.M{"$unwind": "$tags"})
+			}
+			pipeline = append(pipeline, trendPipeline(groupBy)...)
+
+			var items []models.Trend
+			cursor, err := activity.Aggregate(ctx, pipeline)
+			if err != nil {
+				return err
+			}
+
+			if err = cursor.All(ctx, &items); err != nil {
+				return err
+			}
+
+			if items == nil {
+				items = []models.Trend{}
+			}
+
+			update := bson.M{"$set": bson.M{"items": items, "computed_at": now}}
+			_, err = trends.UpdateOne(ctx, bson.M{"_id": trendsID(kind, name)}, update, options.Update().SetUpsert(true))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// stages grouping the matched activity by the given field into the best scored trends
+func trendPipeline(groupBy string) []bson.M {
+	countKind := func(kind string) bson.M {
+		return bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$kind", kind}}, 1, 0}}}
+	}
+
+	return []bson.M{
+		{"$group": bson.M{"_id": groupBy, "likes": countKind(models.ActivityLike), "comments": countKind(models.ActivityComment)}},
+		{"$project": bson.M{
+			"_id":      0,
+			"key":      "$_id",
+			"likes":    1,
+			"comments": 1,
+			"score": bson.M{"$add": bson.A{
+				bson.M{"$multiply": bson.A{"$likes", trendLikeWeight}},
+				bson.M{"$multiply": bson.A{"$comments", trendCommentWeight}},
+			}},
+		}},
+		{"$sort": bson.D{{Key: "score", Value: -1}, {Key: "key", Value: -1}}},
+		{"$limit": cfg.TrendingSize},
+	}
+}
+
+// id of the stored trends of a kind and window
+func trendsID(kind, window string) string {
+	return kind + ":" + window
+}
+
+// Retrieve a page of the trending posts of the window that are still visible to anyone
+func GetTrendingPosts(ctx context.Context, window string, query models.PageQuery, posts, trends CollectionAPI) ([]models.TrendingPost, string, *echo.HTTPError) {
+	items, offset, httpErr := findTrends(ctx, "posts", window, query, trends)
+	if httpErr != nil {
+		return nil, "", httpErr
+	}
+
+	page := trendsPage(items, offset, query)
+	ids := []primitive.ObjectID{}
+	for _, item := range page {
+		if docID, err := primitive.ObjectIDFromHex(item.Key); err == nil {
+			ids = append(ids, docID)
+		}
+	}
+
+	filter := publicFilter()
+	filter["_id"] = bson.M{"$in": ids}
+
+	var found []models.Post
+	cursor, err := posts.Find(ctx, filter)
+	if err != nil {
+		return nil, "", echo.NewHTTPError(404, "Unable to find posts")
+	}
+
+	if err = cursor.All(ctx, &found); err != nil {
+		return nil, "", echo.NewHTTPError(500, "Unable to parse retrieved posts")
+	}
+
+	visible := make(map[string]models.Post, len(found))
+	for _, post := range found {
+		visible[post.ID.Hex()] = post
+	}
+
+	// posts deleted or hidden since the trends were computed are left out
+	trending := []models.TrendingPost{}
+	for _, item := range page {
+		if post, ok := visible[item.Key]; ok {
+			trending = append(trending, models.TrendingPost{Post: post, Trend: item})
+		}
+	}
+
+	return trending, nextOffsetCursor(offset, offset+query.Limit < len(items), query), nil
+}
+
+// Retrieve a page of the trending tags of the window
+func GetTrendingTags(ctx context.Context, window string, query models.PageQuery, trends CollectionAPI) ([]models.TrendingTag, string, *echo.HTTPError) {
+	items, offset, httpErr := findTrends(ctx, "tags", window, query, trends)
+	if httpErr != nil {
+		return nil, "", httpErr
+	}
+
+	trending := []models.TrendingTag{}
+	for _, item := range trendsPage(items, offset, query) {
+		trending = append(trending, models.TrendingTag{Tag: item.Key, Trend: item})
+	}
+
+	return trending, nextOffsetCursor(offset, offset+query.Limit < len(items), query), nil
+}
+
+// retrieve the stored trends of a kind and window with the offset of the requested page.
+// Trends not computed yet are empty
+func findTrends(ctx context.Context, kind, window string, query models.PageQuery, collection CollectionAPI) ([]models.Trend, int, *echo.HTTPError) {
+	if _, ok := trendWindows[window]; !ok {
+		return nil, 0, echo.NewHTTPError(400, "Invalid window")
+	}
+
+	offset, httpErr := pageOffset(query)
+	if httpErr != nil {
+		return nil, 0, httpErr
+	}
+
+	var trends models.Trends
+	err := collection.FindOne(ctx, bson.M{"_id": trendsID(kind, window)}).Decode(&trends)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, 0, echo.NewHTTPError(500, "Unable to parse retrieved trends")
+	}
+
+	return trends.Items, offset, nil
+}
+
+// the trends of the page starting at offset
+func trendsPage(items []models.Trend, offset int, query models.PageQuery) []models.Trend {
+	if offset >= len(items) {
+		return nil
+	}
+
+	end := offset + query.Limit
+	if end > len(items) {
+		end = len(items)
+	}
+
+	return items[offset:end]
+}
@@ -0,0 +1,124 @@
+package db
+
+import (
+	"contacts/models"
+	"context"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Retrieve a page of the public profiles of the users waiting for the user to approve their follow request
+func GetFollowRequests(ctx context.Context, id string, query models.PageQuery, collection CollectionAPI) ([]models.PublicProfile, string, *echo.HTTPError) {
+	user, httpErr := FindUser(ctx, id, collection)
+	if httpErr != nil {
+		return nil, "", httpErr
+	}
+
+	return findProfiles(ctx, user.FollowRequests, query, collection)
+}
+
+// Accept the follow request of requesterID to the user id
+func ApproveFollowRequest(ctx context.Context, id, requesterID string, collection CollectionAPI) *echo.HTTPError {
+	if httpErr := takeFollowRequest(ctx, id, requesterID, collection); httpErr != nil {
+		return httpErr
+	}
+
+	toDocID, _ := primitive.ObjectIDFromHex(id)
+	fromDocID, err := primitive.ObjectIDFromHex(requesterID)
+	if err != nil {
+		return echo.NewHTTPError(400, "Unable to convert to object id")
+	}
+
+	return addFollow(ctx, fromDocID, toDocID, collection)
+}
+
+// Discard the follow request of requesterID to the user id
+func RejectFollowRequest(ctx context.Context, id, requesterID string, collection CollectionAPI) *echo.HTTPError {
+	return takeFollowRequest(ctx, id, requesterID, collection)
+}
+
+// remove the pending follow request, failing if it does not exist
+func takeFollowRequest(ctx context.Context, id, requesterID string, collection CollectionAPI) *echo.HTTPError {
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return echo.NewHTTPError(400, "Unable to convert to object id")
+	}
+
+	filter := bson.M{"_id": docID, "follow_requests": requesterID}
+	res, err := collection.UpdateOne(ctx, filter, bson.M{"$pull": bson.M{"follow_requests": requesterID}})
+	if err != nil {
+		return echo.NewHTTPError(500, "Unable to update user")
+	}
+
+	if res.ModifiedCount == 0 {
+		return echo.NewHTTPError(404, "Follow request does not exist")
+	}
+
+	return nil
+}
+
+// Retrieve a page of the public profiles of the followers of the user
+func GetUserFollowers(ctx context.Context, id primitive.ObjectID, query models.PageQuery, collection CollectionAPI) ([]models.PublicProfile, string, *echo.HTTPError) {
+	user, httpErr := FindUser(ctx, id.Hex(), collection)
+	if httpErr != nil {
+		return nil, "", httpErr
+	}
+
+	return findProfiles(ctx, user.Followers, query, collection)
+}
+
+// Retrieve a page of the public profiles of the users followed by the user
+func GetUserFollowing(ctx context.Context, id primitive.ObjectID, query models.PageQuery, collection CollectionAPI) ([]models.PublicProfile, string, *echo.HTTPError) {
+	user, httpErr := FindUser(ctx, id.Hex(), collection)
+	if httpErr != nil {
+		return nil, "", httpErr
+	}
+
+	return findProfiles(ctx, user.Following, query, collection)
+}
+
+// Retrieve a page of the public profiles of the users that follow the user and are followed back
+func GetMutualFollows(ctx context.Context, id primitive.ObjectID, query models.PageQuery, collection CollectionAPI) ([]models.PublicProfile, string, *echo.HTTPError) {
+	user, httpErr := FindUser(ctx, id.Hex(), collection)
+	if httpErr != nil {
+		return nil, "", httpErr
+	}
+
+	var mutuals []string
+	for _, followingID := range user.Following {
+		if contains(user.Followers, followingID) {
+			mutuals = append(mutuals, followingID)
+		}
+	}
+
+	return findProfiles(ctx, mutuals, query, collection)
+}
+
+// Get how the user id relates to the other user. Blocks are only included when the viewer is the user
+func GetRelationship(ctx context.Context, id, otherID, viewerID string, collection CollectionAPI) (models.Relationship, *echo.HTTPError) {
+	var relationship models.Relationship
+
+	user, httpErr := FindUser(ctx, id, collection)
+	if httpErr != nil {
+		return relationship, httpErr
+	}
+
+	other, httpErr := FindUser(ctx, otherID, collection)
+	if httpErr != nil {
+		return relationship, httpErr
+	}
+
+	relationship.Follows = contains(other.Followers, id)
+	relationship.FollowedBy = contains(user.Followers, otherID)
+	relationship.Requested = contains(other.FollowRequests, id)
+
+	if viewerID == id {
+		blocking := contains(user.Blocked, otherID)
+		blockedBy := contains(other.Blocked, id)
+		relationship.Blocking, relationship.BlockedBy = &blocking, &blockedBy
+	}
+
+	return relationship, nil
+}
@@ -4,6 +4,7 @@ import (
 	"contacts/config"
 	"context"
 	"fmt"
+	"sync"
 
 	"github.com/ilyakaznacheev/cleanenv"
 	"go.mongodb.org/mongo-driver/bson"
@@ -14,11 +15,29 @@ import (
 // collection interface
 type CollectionAPI interface {
 	InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error)
+	InsertMany(ctx context.Context, documents []interface{}, opts ...*options.InsertManyOptions) (*mongo.InsertManyResult, error)
 	Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error)
 	FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult
 	UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error)
+	UpdateMany(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error)
 	DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error)
+	DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error)
 	FindOneAndUpdate(ctx context.Context, filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) *mongo.SingleResult
+	CountDocuments(ctx context.Context, filter interface{}, opts ...*options.CountOptions) (int64, error)
+	Aggregate(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error)
+}
+
+var (
+	cfg        config.Properties
+	sharedDB   *mongo.Database
+	sharedOnce sync.Once
+)
+
+// init read configuration settings
+func init() {
+	if err := cleanenv.ReadEnv(&cfg); err != nil {
+		panic("Unable to read configuration")
+	}
 }
 
 // Get connection to the db and retrieve users and posts collections
@@ -56,10 +75,77 @@ func GetConnection() (*mongo.Collection, *mongo.Collection) {
 		},
 	}
 
-	_, err = db.Collection("users").Indexes().CreateMany(ctx, []mongo.IndexModel{usernameIndexModel, emailIndexModel})
+	// users that blocked or requested to follow someone are looked up by those lists
+	blockedIndexModel := mongo.IndexModel{Keys: bson.M{"blocked": 1}}
+	requestsIndexModel := mongo.IndexModel{Keys: bson.M{"follow_requests": 1}}
+
+	// the most followed users are suggested to everyone
+	popularIndexModel := mongo.IndexModel{Keys: bson.D{{Key: "followers_count", Value: -1}, {Key: "_id", Value: 1}}}
+
+	// private users are looked up on startup to mark their posts
+	privateIndexModel := mongo.IndexModel{Keys: bson.M{"private": 1}}
+
+	// users waiting for the timeline backfill are claimed by the fan-out worker
+	rebuildIndexModel := mongo.IndexModel{Keys: bson.M{"timeline_rebuild": 1}, Options: options.Index().SetSparse(true)}
+	backfillIndexModel := mongo.IndexModel{Keys: bson.M{"timeline_backfill": 1}, Options: options.Index().SetSparse(true)}
+
+	// users whose deletion is due are claimed by the deletion worker
+	deletionIndexModel := mongo.IndexModel{Keys: bson.M{"deletion_due_at": 1}, Options: options.Index().SetSparse(true)}
+
+	// users and posts are searched with their text indexes, a collection can only have one
+	usersIndexes := []mongo.IndexModel{
+		usernameIndexModel, emailIndexModel, blockedIndexModel, requestsIndexModel, popularIndexModel, privateIndexModel,
+		rebuildIndexModel, backfillIndexModel, deletionIndexModel, textIndexModel(usersTextWeights),
+	}
+	_, err = db.Collection("users").Indexes().CreateMany(ctx, usersIndexes)
 	if err != nil {
 		panic("Unable to create indexes")
 	}
 
+	// lists of published posts are paginated latest published first, overall, by author or by tag,
+	// the posts of an owner including its drafts are paginated newest first
+	authorIndexModel := mongo.IndexModel{Keys: bson.D{{Key: "from", Value: 1}, {Key: "_id", Value: -1}}}
+	publishedIndexModel := mongo.IndexModel{Keys: bson.D{{Key: "published_at", Value: -1}, {Key: "_id", Value: -1}}}
+	authorPublishedIndexModel := mongo.IndexModel{Keys: bson.D{{Key: "from", Value: 1}, {Key: "published_at", Value: -1}, {Key: "_id", Value: -1}}}
+	tagsIndexModel := mongo.IndexModel{Keys: bson.D{{Key: "tags", Value: 1}, {Key: "published_at", Value: -1}, {Key: "_id", Value: -1}}}
+	scheduledIndexModel := mongo.IndexModel{Keys: bson.D{{Key: "status", Value: 1}, {Key: "publish_at", Value: 1}}}
+	deletedIndexModel := mongo.IndexModel{Keys: bson.M{"deleted_at": 1}}
+	fanoutIndexModel := mongo.IndexModel{Keys: bson.M{"fanout_pending": 1}, Options: options.Index().SetSparse(true)}
+
+	// the ranked feed counts the likes and comments of the reader by author
+	likedByIndexModel := mongo.IndexModel{Keys: bson.D{{Key: "liked_by", Value: 1}, {Key: "from", Value: 1}}}
+	commentersIndexModel := mongo.IndexModel{Keys: bson.D{{Key: "comments.from", Value: 1}, {Key: "from", Value: 1}}}
+
+	postsIndexes := []mongo.IndexModel{
+		authorIndexModel, publishedIndexModel, authorPublishedIndexModel, tagsIndexModel, scheduledIndexModel, deletedIndexModel, fanoutIndexModel,
+		likedByIndexModel, commentersIndexModel, textIndexModel(postsTextWeights),
+	}
+	if _, err = postsCollection.Indexes().CreateMany(ctx, postsIndexes); err != nil {
+		panic("Unable to create indexes")
+	}
+
 	return usersCollection, postsCollection
 }
+
+// Get a collection by name from a connection shared by the whole process and create the given indexes.
+// Unlike GetConnection the client is never disconnected, so it is meant to be called once at startup
+func GetCollection(name string, indexes ...mongo.IndexModel) *mongo.Collection {
+	sharedOnce.Do(func() {
+		connectURI := fmt.Sprintf("mongodb://%s:%s", cfg.DBHost, cfg.DBPort)
+		client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(connectURI))
+		if err != nil {
+			panic("Unable to connect to mongo")
+		}
+
+		sharedDB = client.Database(cfg.DBName)
+	})
+
+	collection := sharedDB.Collection(name)
+	if len(indexes) > 0 {
+		if _, err := collection.Indexes().CreateMany(context.Background(), indexes); err != nil {
+			panic("Unable to create indexes")
+		}
+	}
+
+	return collection
+}
@@ -0,0 +1,137 @@
+package db
+
+import (
+	"contacts/models"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// position of a page in a list. Lists sorted by id continue after the last id, lists of published
+// posts after the publication date and id of the last post, ranked lists continue after the amount
+// of items already returned, ranked at the same time
+type pageCursor struct {
+	After     *primitive.ObjectID `json:"a,omitempty"`
+	Published *time.Time          `json:"p,omitempty"`
+	Offset    int                 `json:"o,omitempty"`
+	At        int64               `json:"t,omitempty"`
+}
+
+// encode the cursor so clients can not rely on its content
+func encodeCursor(cursor pageCursor) string {
+	raw, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decode the cursor of the query, an empty cursor is the first page
+func decodeCursor(query models.PageQuery) (pageCursor, *echo.HTTPError) {
+	var cursor pageCursor
+	if query.Cursor == "" {
+		return cursor, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(query.Cursor)
+	if err != nil || json.Unmarshal(raw, &cursor) != nil || cursor.Offset < 0 {
+		return cursor, echo.NewHTTPError(400, "Invalid cursor")
+	}
+
+	return cursor, nil
+}
+
+// find a page of the documents matching the filter newest first, decode them into results,
+// a pointer to a slice, and return the cursor of the next page
+func findPage(ctx context.Context, collection CollectionAPI, filter bson.M, query models.PageQuery, results interface{}) (string, *echo.HTTPError) {
+	return findSortedPage(ctx, collection, filter, query, false, results)
+}
+
+// find a page of the published posts matching the filter latest published first, so posts published
+// after being drafted or scheduled are listed when they are published rather than when they were created
+func findPublishedPage(ctx context.Context, collection CollectionAPI, filter bson.M, query models.PageQuery, results interface{}) (string, *echo.HTTPError) {
+	return findSortedPage(ctx, collection, filter, query, true, results)
+}
+
+// filter of the items after the cursor in a list sorted by publication date then id, latest first
+func publishedAfter(cursor pageCursor, dateField, idField string) bson.M {
+	return bson.M{"$or": bson.A{
+		bson.M{dateField: bson.M{"$lt": *cursor.Published}},
+		bson.M{dateField: *cursor.Published, idField: bson.M{"$lt": *cursor.After}},
+	}}
+}
+
+// find a page of the documents matching the filter sorted by id or by publication date then id
+func findSortedPage(ctx context.Context, collection CollectionAPI, filter bson.M, query models.PageQuery, published bool, results interface{}) (string, *echo.HTTPError) {
+	cursor, httpErr := decodeCursor(query)
+	if httpErr != nil {
+		return "", httpErr
+	}
+
+	if published && cursor.After != nil && cursor.Published == nil {
+		return "", echo.NewHTTPError(400, "Invalid cursor")
+	}
+
+	order := bson.D{{Key: "_id", Value: -1}}
+	if published {
+		order = bson.D{{Key: "published_at", Value: -1}, {Key: "_id", Value: -1}}
+	}
+
+	if published && cursor.After != nil {
+		filter = bson.M{"$and": bson.A{filter, publishedAfter(cursor, "published_at", "_id")}}
+	} else if cursor.After != nil {
+		filter = bson.M{"$and": bson.A{filter, bson.M{"_id": bson.M{"$lt": *cursor.After}}}}
+	}
+
+	opts := options.Find().SetSort(order).SetLimit(int64(query.Limit) + 1)
+	found, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return "", echo.NewHTTPError(404, "Unable to find documents")
+	}
+
+	var docs []bson.Raw
+	if err = found.All(ctx, &docs); err != nil {
+		return "", echo.NewHTTPError(500, "Unable to parse retrieved documents")
+	}
+
+	next := ""
+	if len(docs) > query.Limit {
+		docs = docs[:query.Limit]
+		last := docs[len(docs)-1]
+		lastID := last.Lookup("_id").ObjectID()
+		next = encodeCursor(pageCursor{After: &lastID})
+		if published {
+			publishedAt, _ := last.Lookup("published_at").TimeOK()
+			next = encodeCursor(pageCursor{After: &lastID, Published: &publishedAt})
+		}
+	}
+
+	slice := reflect.ValueOf(results).Elem()
+	slice.Set(reflect.MakeSlice(slice.Type(), len(docs), len(docs)))
+	for i, doc := range docs {
+		if err = bson.Unmarshal(doc, slice.Index(i).Addr().Interface()); err != nil {
+			return "", echo.NewHTTPError(500, "Unable to parse retrieved documents")
+		}
+	}
+
+	return next, nil
+}
+
+// get where the page of a ranked list starts
+func pageOffset(query models.PageQuery) (int, *echo.HTTPError) {
+	cursor, httpErr := decodeCursor(query)
+	return cursor.Offset, httpErr
+}
+
+// get the cursor of the page after the one starting at offset, empty if there are no more items
+func nextOffsetCursor(offset int, more bool, query models.PageQuery) string {
+	if !more {
+		return ""
+	}
+
+	return encodeCursor(pageCursor{Offset: offset + query.Limit})
+}
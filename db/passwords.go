@@ -0,0 +1,87 @@
+package db
+
+import (
+	"contacts/models"
+	"context"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// indexes of the password resets collection. Expired resets are removed by mongo
+var PasswordResetIndexes = []mongo.IndexModel{
+	{Keys: bson.M{"token_hash": 1}},
+	{Keys: bson.M{"user_id": 1}},
+	{Keys: bson.M{"expires_at": 1}, Options: options.Index().SetExpireAfterSeconds(0)},
+}
+
+// Create a single use reset token for the user with the given email
+func CreatePasswordReset(ctx context.Context, email string, users, resets CollectionAPI) (models.User, string, *echo.HTTPError) {
+	var user models.User
+
+	result := users.FindOne(ctx, bson.M{"email": email})
+	err := result.Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return user, "", echo.NewHTTPError(404, "User does not exist")
+	}
+
+	if err != nil {
+		return user, "", echo.NewHTTPError(500, "Unable to decode retrieved user")
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return user, "", echo.NewHTTPError(500, "Unable to create reset token")
+	}
+
+	now := time.Now()
+	reset := models.PasswordReset{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID.Hex(),
+		TokenHash: hashToken(token),
+		CreatedAt: now,
+		ExpiresAt: now.Add(cfg.PasswordResetTTL),
+	}
+
+	if _, err = resets.InsertOne(ctx, reset); err != nil {
+		return user, "", echo.NewHTTPError(500, "Unable to create reset token")
+	}
+
+	return user, token, nil
+}
+
+// Consume the reset token and set the new password of its user.
+// Every other pending reset token of the user is discarded
+func ResetPassword(ctx context.Context, token, password string, users, resets CollectionAPI) (string, *echo.HTTPError) {
+	var reset models.PasswordReset
+
+	filter := bson.M{"token_hash": hashToken(token), "used": false, "expires_at": bson.M{"$gt": time.Now()}}
+	result := resets.FindOneAndUpdate(ctx, filter, bson.M{"$set": bson.M{"used": true}})
+	if err := result.Decode(&reset); err != nil {
+		return "", echo.NewHTTPError(400, "Invalid or expired reset token")
+	}
+
+	docID, err := primitive.ObjectIDFromHex(reset.UserID)
+	if err != nil {
+		return "", echo.NewHTTPError(500, "Unable to convert to object id")
+	}
+
+	hashpwd, err := hashPassword(password)
+	if err != nil {
+		return "", echo.NewHTTPError(500, "Unable to hash password")
+	}
+
+	if _, err = users.UpdateOne(ctx, bson.M{"_id": docID}, bson.M{"$set": bson.M{"password": hashpwd}}); err != nil {
+		return "", echo.NewHTTPError(500, "Unable to update password")
+	}
+
+	if _, err = resets.UpdateMany(ctx, bson.M{"user_id": reset.UserID, "used": false}, bson.M{"$set": bson.M{"used": true}}); err != nil {
+		return "", echo.NewHTTPError(500, "Unable to discard reset tokens")
+	}
+
+	return reset.UserID, nil
+}
@@ -1,10 +1,10 @@
 package db
 
 import (
+	"contacts/markdown"
 	"contacts/models"
 	"context"
-	"encoding/json"
-	"io"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"go.mongodb.org/mongo-driver/bson"
@@ -13,8 +13,30 @@ import (
 )
 
 // insert the post in the db
-func InsertPost(ctx context.Context, post models.Post, collection CollectionAPI) (*mongo.InsertOneResult, *echo.HTTPError) {
+func InsertPost(ctx context.Context, post models.Post, users, collection CollectionAPI) (*mongo.InsertOneResult, *echo.HTTPError) {
+	author, httpErr := FindUser(ctx, post.From, users)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+
 	post.ID = primitive.NewObjectID()
+	post.AuthorPrivate = author.Private
+	post.DeletedAt, post.DeletedBy = nil, ""
+	post.Likes, post.LikedBy = 0, nil
+	post.Comments, post.DeletedComments = []models.Comment{}, nil
+	post.Revisions, post.EditedAt = 0, nil
+	if httpErr := renderPost(&post); httpErr != nil {
+		return nil, httpErr
+	}
+
+	if httpErr := tagPost(&post); httpErr != nil {
+		return nil, httpErr
+	}
+
+	post.PublishedAt = nil
+	if httpErr := preparePublication(&post, time.Now()); httpErr != nil {
+		return nil, httpErr
+	}
 
 	result, err := collection.InsertOne(ctx, post)
 	if err != nil {
@@ -33,7 +55,7 @@ func FindPost(ctx context.Context, id string, collection CollectionAPI) (models.
 		return post, echo.NewHTTPError(400, "Unable to convert to object id")
 	}
 
-	result := collection.FindOne(ctx, bson.M{"_id": docID})
+	result := collection.FindOne(ctx, bson.M{"_id": docID, "deleted_at": nil})
 	if err = result.Decode(&post); err != nil {
 		return post, echo.NewHTTPError(404, "Post not found")
 	}
@@ -41,120 +63,111 @@ func FindPost(ctx context.Context, id string, collection CollectionAPI) (models.
 	return post, nil
 }
 
-// Get posts based on the users that the requesting user is following
-func FindPosts(ctx context.Context, follows []string, collection CollectionAPI) ([]models.Post, *echo.HTTPError) {
+// Get a page of the published posts based on the users and tags that the requesting user is following.
+// Posts of followed tags leave out the hidden authors
+func FindPosts(ctx context.Context, viewer models.User, follows, tags, hidden []string, query models.PageQuery, collection CollectionAPI) ([]models.Post, string, *echo.HTTPError) {
 	var posts []models.Post
 
-	cursor, err := collection.Find(ctx, bson.M{"from": bson.M{"$in": follows}})
-	if err != nil {
-		return posts, echo.NewHTTPError(404, "Unable to find posts")
-	}
-
-	if err = cursor.All(ctx, &posts); err != nil {
-		return posts, echo.NewHTTPError(500, "Unable to parse retrieved posts")
+	filter := publishedFilter()
+	filter["from"] = bson.M{"$in": follows}
+	if len(tags) > 0 {
+		delete(filter, "from")
+		filter["$or"] = bson.A{
+			bson.M{"from": bson.M{"$in": follows}},
+			bson.M{"tags": bson.M{"$in": tags}, "$and": bson.A{visibleFilter(viewer, hidden)}},
+		}
 	}
 
-	return posts, nil
+	next, httpErr := findPublishedPage(ctx, collection, filter, query, &posts)
+	return posts, next, httpErr
 }
 
-// Delete post from the db
-func DeletePost(ctx context.Context, id string, collection CollectionAPI) (*mongo.DeleteResult, *echo.HTTPError) {
+// Move the post to the trash of its owner, it is removed for good once the retention is over
+func DeletePost(ctx context.Context, id, deletedBy string, collection CollectionAPI) *echo.HTTPError {
 	docID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return nil, echo.NewHTTPError(400, "Unable to convert to object id")
+		return echo.NewHTTPError(400, "Unable to convert to object id")
 	}
 
-	result, err := collection.DeleteOne(ctx, bson.M{"_id": docID})
+	update := bson.M{"$set": bson.M{"deleted_at": time.Now(), "deleted_by": deletedBy}}
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": docID, "deleted_at": nil}, update)
 	if err != nil {
-		return nil, echo.NewHTTPError(500, "unable to delete post")
+		return echo.NewHTTPError(500, "unable to delete post")
 	}
 
-	if result.DeletedCount == 0 {
-		return nil, echo.NewHTTPError(404, "Post id does not exist")
+	if result.MatchedCount == 0 {
+		return echo.NewHTTPError(404, "Post id does not exist")
 	}
 
-	return result, nil
+	return nil
 }
 
-// Handle update post data
-func UpdatePost(ctx context.Context, id string, reqBody io.ReadCloser, collection CollectionAPI) (models.Post, *echo.HTTPError) {
-	var post models.Post
-
-	docID, err := primitive.ObjectIDFromHex(id)
-	if err != nil {
-		return post, echo.NewHTTPError(400, "Unable to convert to object id")
-	}
-	filter := bson.M{"_id": docID}
-	result := collection.FindOne(ctx, filter)
-
-	if err = result.Decode(&post); err != nil {
-		return post, echo.NewHTTPError(404, "Post not found")
-	}
+// Handle update post data, the previous post is kept as a revision when the content changed
+func UpdatePost(ctx context.Context, previous, post models.Post, editorID string, collection, revisions CollectionAPI) (models.Post, *echo.HTTPError) {
+	return savePost(ctx, previous, post, editorID, collection, revisions)
+}
 
-	if err := json.NewDecoder(reqBody).Decode(&post); err != nil {
-		return post, echo.NewHTTPError(422, "Unable to parse request payload")
+// render the markdown body of the post to sanitized html, html given by the client is never kept
+func renderPost(post *models.Post) *echo.HTTPError {
+	post.HTML = ""
+	if post.Body == "" {
+		return nil
 	}
 
-	if _, err = collection.UpdateOne(ctx, filter, bson.M{"$set": post}); err != nil {
-		return post, echo.NewHTTPError(500, "Unable to update post")
+	html, err := markdown.Render(post.Body)
+	if err != nil {
+		return echo.NewHTTPError(422, "Unable to render post body")
 	}
 
-	return post, nil
+	post.HTML = html
+	return nil
 }
 
-// Retrieve all posts from one user
-func RetrievetUserPosts(ctx context.Context, id string, collection CollectionAPI) ([]models.Post, *echo.HTTPError) {
+// Retrieve a page of the posts from one user, drafts and scheduled posts are only included for the owner,
+// who gets them newest first. Others get the published posts latest published first
+func RetrievetUserPosts(ctx context.Context, id string, owner bool, query models.PageQuery, collection CollectionAPI) ([]models.Post, string, *echo.HTTPError) {
 	var posts []models.Post
 
-	cursor, err := collection.Find(ctx, bson.M{"from": id})
-	if err != nil {
-		return nil, echo.NewHTTPError(404, "Unable to find posts")
-	}
-
-	if err = cursor.All(ctx, &posts); err != nil {
-		return nil, echo.NewHTTPError(500, "Unable to decode retrieved posts")
+	if owner {
+		next, httpErr := findPage(ctx, collection, bson.M{"from": id, "deleted_at": nil}, query, &posts)
+		return posts, next, httpErr
 	}
 
-	return posts, nil
+	filter := publishedFilter()
+	filter["from"] = id
+	next, httpErr := findPublishedPage(ctx, collection, filter, query, &posts)
+	return posts, next, httpErr
 }
 
-// check if requesting user already like the post and remove or add the like to the post
-func SetLike(ctx context.Context, userID, postID string, collection CollectionAPI) *echo.HTTPError {
-	var post models.Post
-
+// check if requesting user already like the post and remove or add the like to the post.
+// Return whether the post is liked now
+func SetLike(ctx context.Context, userID, postID string, collection CollectionAPI) (bool, *echo.HTTPError) {
 	docID, err := primitive.ObjectIDFromHex(postID)
 	if err != nil {
-		return echo.NewHTTPError(500, "Unable to convert to object id")
+		return false, echo.NewHTTPError(500, "Unable to convert to object id")
 	}
 
-	result := collection.FindOne(ctx, bson.M{"_id": docID})
-	if result.Err() != nil {
-		return echo.NewHTTPError(400, "Post does not exist")
+	like := bson.M{"$addToSet": bson.M{"liked_by": userID}, "$inc": bson.M{"likes": 1}}
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": docID, "liked_by": bson.M{"$ne": userID}}, like)
+	if err != nil {
+		return false, echo.NewHTTPError(500, "Unable to update post")
 	}
 
-	if err = result.Decode(&post); err != nil {
-		return echo.NewHTTPError(500, "uanble to decode retrieved post")
+	if result.MatchedCount > 0 {
+		return true, nil
 	}
 
-	if !contains(post.LikedBy, userID) {
-		post.LikedBy = append(post.LikedBy, userID)
-		post.Likes++
+	unlike := bson.M{"$pull": bson.M{"liked_by": userID}, "$inc": bson.M{"likes": -1}}
+	result, err = collection.UpdateOne(ctx, bson.M{"_id": docID, "liked_by": userID}, unlike)
+	if err != nil {
+		return false, echo.NewHTTPError(500, "Unable to update post")
+	}
 
-		_, err = collection.UpdateOne(ctx, bson.M{"_id": docID}, bson.M{"$set": post})
-		if err != nil {
-			return echo.NewHTTPError(500, "Unable to update post")
-		}
-	} else {
-		index := GetIndex(post.LikedBy, userID)
-		post.LikedBy = append(post.LikedBy[:index], post.LikedBy[index+1:]...)
-		post.Likes--
-		_, err = collection.UpdateOne(ctx, bson.M{"_id": docID}, bson.M{"$set": post})
-		if err != nil {
-			return echo.NewHTTPError(500, "Unable to update post")
-		}
+	if result.MatchedCount == 0 {
+		return false, echo.NewHTTPError(400, "Post does not exist")
 	}
 
-	return nil
+	return false, nil
 }
 
 func contains(s []string, str string) bool {
@@ -0,0 +1,138 @@
+package db
+
+import (
+	"contacts/models"
+	"context"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// filter of the posts visible to everyone: published and not deleted. Posts without status
+// were published before it existed
+func publishedFilter() bson.M {
+	return bson.M{"status": bson.M{"$in": bson.A{nil, models.PostPublished}}, "deleted_at": nil}
+}
+
+// check if the post is visible to everyone
+func IsPublished(post models.Post) bool {
+	return post.Status == "" || post.Status == models.PostPublished
+}
+
+// set the publication fields of the post according to its status. Posts are published by default,
+// scheduled posts need a publish date in the future. Posts published now wait for the fan-out
+func preparePublication(post *models.Post, now time.Time) *echo.HTTPError {
+	switch post.Status {
+	case "", models.PostPublished:
+		post.Status = models.PostPublished
+		post.PublishAt = nil
+		if post.PublishedAt == nil {
+			post.PublishedAt = &now
+			post.FanoutPending = true
+		}
+	case models.PostScheduled:
+		if post.PublishAt == nil || !post.PublishAt.After(now) {
+			return echo.NewHTTPError(400, "Scheduled posts need a publish_at date in the future")
+		}
+		post.PublishedAt = nil
+	case models.PostDraft:
+		post.PublishAt = nil
+		post.PublishedAt = nil
+	default:
+		return echo.NewHTTPError(400, "Invalid post status")
+	}
+
+	return nil
+}
+
+// Retrieve a page of the drafts and scheduled posts of the user
+func GetDrafts(ctx context.Context, userID string, query models.PageQuery, collection CollectionAPI) ([]models.Post, string, *echo.HTTPError) {
+	var posts []models.Post
+
+	filter := bson.M{"from": userID, "status": bson.M{"$in": bson.A{models.PostDraft, models.PostScheduled}}, "deleted_at": nil}
+	next, httpErr := findPage(ctx, collection, filter, query, &posts)
+	return posts, next, httpErr
+}
+
+// Publish now a draft or scheduled post
+func PublishPost(ctx context.Context, id string, collection CollectionAPI) (models.Post, *echo.HTTPError) {
+	var post models.Post
+
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return post, echo.NewHTTPError(400, "Unable to convert to object id")
+	}
+
+	filter := bson.M{"_id": docID, "status": bson.M{"$in": bson.A{models.PostDraft, models.PostScheduled}}, "deleted_at": nil}
+	result := collection.FindOneAndUpdate(ctx, filter, publishUpdate(time.Now()), options.FindOneAndUpdate().SetReturnDocument(options.After))
+	err = result.Decode(&post)
+	if err == mongo.ErrNoDocuments {
+		return post, echo.NewHTTPError(409, "Post does not exist or is already published")
+	}
+
+	if err != nil {
+		return post, echo.NewHTTPError(500, "Unable to publish post")
+	}
+
+	return post, nil
+}
+
+// Publish one scheduled post whose publish date is due. The status change is atomic
+// so every post is published by a single instance
+func PublishDuePost(ctx context.Context, collection CollectionAPI) (models.Post, bool, error) {
+	var post models.Post
+
+	now := time.Now()
+	filter := bson.M{"status": models.PostScheduled, "publish_at": bson.M{"$lte": now}, "deleted_at": nil}
+	result := collection.FindOneAndUpdate(ctx, filter, publishUpdate(now), options.FindOneAndUpdate().SetReturnDocument(options.After))
+	err := result.Decode(&post)
+	if err == mongo.ErrNoDocuments {
+		return post, false, nil
+	}
+
+	if err != nil {
+		return post, false, err
+	}
+
+	return post, true, nil
+}
+
+// update that marks a post as published at the given time and waiting for the fan-out
+func publishUpdate(now time.Time) bson.M {
+	return bson.M{
+		"$set":   bson.M{"status": models.PostPublished, "published_at": now, "fanout_pending": true},
+		"$unset": bson.M{"publish_at": "", "fanout_lock": ""},
+	}
+}
+
+// Date the published posts stored before the publication date was kept by their creation, and the
+// timeline entries delivered before by the date of their post, so they are listed with the others
+func SyncPublishedAt(ctx context.Context, posts, timelines CollectionAPI) error {
+	filter := bson.M{"status": bson.M{"$in": bson.A{nil, models.PostPublished}}, "published_at": nil}
+	created := bson.A{bson.M{"$set": bson.M{"published_at": bson.M{"$toDate": "$_id"}}}}
+	if _, err := posts.UpdateMany(ctx, filter, created); err != nil {
+		return err
+	}
+
+	pipeline := []bson.M{
+		{"$match": bson.M{"published_at": bson.M{"$exists": false}}},
+		{"$lookup": bson.M{"from": cfg.PostsCollection, "localField": "post_id", "foreignField": "_id", "as": "post"}},
+		{"$set": bson.M{"published_at": bson.M{"$ifNull": bson.A{
+			bson.M{"$arrayElemAt": bson.A{"$post.published_at", 0}},
+			bson.M{"$toDate": "$post_id"},
+		}}}},
+		{"$project": bson.M{"post": 0}},
+		{"$merge": bson.M{"into": cfg.TimelinesCollection, "on": "_id", "whenMatched": "merge", "whenNotMatched": "discard"}},
+	}
+
+	result, err := timelines.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+
+	return result.Close(ctx)
+}
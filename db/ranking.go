@@ -0,0 +1,152 @@
+package db
+
+import (
+	"contacts/models"
+	"contacts/ranking"
+	"context"
+	"sort"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Get the time a ranked feed is ranked at, kept in the cursor, and the query of its candidates: the
+// latest posts of the feed published at or before that time, so every page is ranked from the same posts
+func RankingPool(query models.PageQuery, pool int) (time.Time, models.PageQuery, *echo.HTTPError) {
+	cursor, httpErr := decodeCursor(query)
+	if httpErr != nil {
+		return time.Time{}, query, httpErr
+	}
+
+	at := time.Now().Unix()
+	if cursor.At != 0 {
+		at = cursor.At
+	}
+
+	// the feed continues after the posts published before the end of the second ranked at
+	before, after := time.Unix(at+1, 0), primitive.NilObjectID
+	start := encodeCursor(pageCursor{After: &after, Published: &before})
+	return time.Unix(at, 0), models.PageQuery{Limit: pool, Cursor: start}, nil
+}
+
+// Rank the candidate posts of the feed of the user with the scorer at the time of the pool and get a page
+// of them. The ranking time is kept in the cursor so the age of the posts does not move them between pages
+func RankPosts(ctx context.Context, userID string, candidates []models.Post, scorer ranking.Scorer, now time.Time, query models.PageQuery, collection CollectionAPI) ([]models.Post, string, *echo.HTTPError) {
+	cursor, httpErr := decodeCursor(query)
+	if httpErr != nil {
+		return nil, "", httpErr
+	}
+
+	authors := []string{}
+	for _, post := range candidates {
+		if !contains(authors, post.From) {
+			authors = append(authors, post.From)
+		}
+	}
+
+	affinity, httpErr := authorAffinity(ctx, userID, authors, collection)
+	if httpErr != nil {
+		return nil, "", httpErr
+	}
+
+	scores := make([]float64, len(candidates))
+	for i, post := range candidates {
+		publishedAt := post.ID.Timestamp()
+		if post.PublishedAt != nil {
+			publishedAt = *post.PublishedAt
+		}
+
+		age := now.Sub(publishedAt)
+		if age < 0 {
+			age = 0
+		}
+
+		scores[i] = scorer.Score(ranking.Signals{
+			Likes:    len(post.LikedBy),
+			Comments: len(post.Comments),
+			Age:      age,
+			Affinity: affinity[post.From],
+		})
+	}
+
+	order := make([]int, len(candidates))
+	for i := range order {
+		order[i] = i
+	}
+
+	sort.Slice(order, func(i, j int) bool {
+		a, b := order[i], order[j]
+		if scores[a] != scores[b] {
+			return scores[a] > scores[b]
+		}
+		return candidates[a].ID.Hex() > candidates[b].ID.Hex()
+	})
+
+	if cursor.Offset >= len(order) {
+		return []models.Post{}, "", nil
+	}
+
+	end := cursor.Offset + query.Limit
+	more := end < len(order)
+	if !more {
+		end = len(order)
+	}
+
+	page := make([]models.Post, 0, end-cursor.Offset)
+	for _, i := range order[cursor.Offset:end] {
+		page = append(page, candidates[i])
+	}
+
+	next := ""
+	if more {
+		next = encodeCursor(pageCursor{Offset: end, At: now.Unix()})
+	}
+
+	return page, next, nil
+}
+
+// count the likes and comments of the user on the posts of every author
+func authorAffinity(ctx context.Context, userID string, authors []string, collection CollectionAPI) (map[string]int, *echo.HTTPError) {
+	affinity := map[string]int{}
+	if len(authors) == 0 {
+		return affinity, nil
+	}
+
+	pipeline := []bson.M{
+		{"$match": bson.M{
+			"from": bson.M{"$in": authors},
+			"$or":  bson.A{bson.M{"liked_by": userID}, bson.M{"comments.from": userID}},
+		}},
+		{"$project": bson.M{
+			"from":  1,
+			"liked": bson.M{"$cond": bson.A{bson.M{"$in": bson.A{userID, bson.M{"$ifNull": bson.A{"$liked_by", bson.A{}}}}}, 1, 0}},
+			"comments": bson.M{"$size": bson.M{"$filter": bson.M{
+				"input": bson.M{"$ifNull": bson.A{"$comments", bson.A{}}},
+				"cond":  bson.M{"$eq": bson.A{"$$this.from", userID}},
+			}}},
+		}},
+		{"$group": bson.M{"_id": "$from", "count": bson.M{"$sum": bson.M{"$add": bson.A{"$liked", "$comments"}}}}},
+	}
+
+	var counts []struct {
+		From  string `bson:"_id"`
+		Count int    `bson:"count"`
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, echo.NewHTTPError(500, "Unable to rank posts")
+	}
+
+	if err = cursor.All(ctx, &counts); err != nil {
+		return nil, echo.NewHTTPError(500, "Unable to parse posts ranking")
+	}
+
+	for _, count := range counts {
+		affinity[count.From] = count.Count
+	}
+
+	return affinity, nil
+}
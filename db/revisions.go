@@ -0,0 +1,203 @@
+package db
+
+import (
+	"contacts/diff"
+	"contacts/models"
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// indexes of the revisions collection. A revision number is only used once per post
+var RevisionIndexes = []mongo.IndexModel{
+	{Keys: bson.D{{Key: "post_id", Value: 1}, {Key: "number", Value: 1}}, Options: options.Index().SetUnique(true)},
+	{Keys: bson.D{{Key: "post_id", Value: 1}, {Key: "_id", Value: -1}}},
+	{Keys: bson.M{"author_id": 1}},
+}
+
+// Retrieve a page of the revisions of the post, newest first
+func ListRevisions(ctx context.Context, postID string, query models.PageQuery, collection CollectionAPI) ([]models.Revision, string, *echo.HTTPError) {
+	var revisions []models.Revision
+
+	next, httpErr := findPage(ctx, collection, bson.M{"post_id": postID}, query, &revisions)
+	return revisions, next, httpErr
+}
+
+// Retrieve one revision of the post by number
+func FindRevision(ctx context.Context, postID, number string, collection CollectionAPI) (models.Revision, *echo.HTTPError) {
+	var revision models.Revision
+
+	n, err := strconv.Atoi(number)
+	if err != nil {
+		return revision, echo.NewHTTPError(400, "Invalid revision number")
+	}
+
+	err = collection.FindOne(ctx, bson.M{"post_id": postID, "number": n}).Decode(&revision)
+	if err == mongo.ErrNoDocuments {
+		return revision, echo.NewHTTPError(404, "Revision does not exist")
+	}
+
+	if err != nil {
+		return revision, echo.NewHTTPError(500, "Unable to decode retrieved revision")
+	}
+
+	return revision, nil
+}
+
+// Compare the revision with the current content of the post
+func DiffRevision(revision models.Revision, post models.Post) models.RevisionDiff {
+	fields := map[string][2]string{
+		"message": {revision.Message, post.Message},
+		"title":   {revision.Title, post.Title},
+		"body":    {revision.Body, post.Body},
+		"excerpt": {revision.Excerpt, post.Excerpt},
+	}
+
+	changes := map[string]string{}
+	for field, values := range fields {
+		if text := diff.Text(values[0], values[1]); text != "" {
+			changes[field] = text
+		}
+	}
+
+	return models.RevisionDiff{Revision: revision, Diff: changes}
+}
+
+// Bring back the content of the revision to the post. The replaced content is kept as a new revision
+func RestoreRevision(ctx context.Context, postID, number, editorID string, collection, revisions CollectionAPI) (models.Post, *echo.HTTPError) {
+	post, httpErr := FindPost(ctx, postID, collection)
+	if httpErr != nil {
+		return post, httpErr
+	}
+
+	revision, httpErr := FindRevision(ctx, postID, number, revisions)
+	if httpErr != nil {
+		return post, httpErr
+	}
+
+	restored := post
+	restored.Message = revision.Message
+	restored.Title = revision.Title
+	restored.Body = revision.Body
+	restored.Excerpt = revision.Excerpt
+
+	return savePost(ctx, post, restored, editorID, collection, revisions)
+}
+
+// store the edited post. When the content changed the previous one is kept as a revision
+// and the post is marked as edited
+func savePost(ctx context.Context, previous, post models.Post, editorID string, collection, revisions CollectionAPI) (models.Post, *echo.HTTPError) {
+	post.ID, post.From = previous.ID, previous.From
+	post.DeletedAt, post.DeletedBy = previous.DeletedAt, previous.DeletedBy
+	if httpErr := renderPost(&post); httpErr != nil {
+		return post, httpErr
+	}
+
+	if httpErr := tagPost(&post); httpErr != nil {
+		return post, httpErr
+	}
+
+	post.PublishedAt = previous.PublishedAt
+	if httpErr := preparePublication(&post, time.Now()); httpErr != nil {
+		return post, httpErr
+	}
+
+	post.EditedAt, post.Revisions = previous.EditedAt, previous.Revisions
+	update := postContentUpdate(post)
+
+	// the post is only updated if nobody trashed it or changed its revisions or status since it was read
+	filter := bson.M{
+		"_id":        post.ID,
+		"revisions":  bson.M{"$in": bson.A{nil, previous.Revisions}},
+		"status":     bson.M{"$in": bson.A{nil, previous.Status}},
+		"deleted_at": nil,
+	}
+
+	var revision models.Revision
+	if contentChanged(previous, post) {
+		now := time.Now()
+		post.Revisions++
+		post.EditedAt = &now
+		update["$set"].(bson.M)["edited_at"] = now
+		update["$inc"] = bson.M{"revisions": 1}
+
+		revision = models.NewRevision(previous, post.Revisions, editorID, now)
+		if _, err := revisions.InsertOne(ctx, revision); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return post, echo.NewHTTPError(409, "The post was edited meanwhile, try again")
+			}
+			return post, echo.NewHTTPError(500, "Unable to store post revision")
+		}
+	}
+
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return post, echo.NewHTTPError(500, "Unable to update post")
+	}
+
+	if result.MatchedCount == 0 {
+		// the revision of the rejected edit is dropped, the number is taken by the other edit
+		if post.Revisions != previous.Revisions {
+			revisions.DeleteOne(ctx, bson.M{"_id": revision.ID})
+		}
+		return post, echo.NewHTTPError(409, "The post was edited meanwhile, try again")
+	}
+
+	return post, nil
+}
+
+// update of the fields an edit can change. Likes, comments and the rest of the post are left as stored
+func postContentUpdate(post models.Post) bson.M {
+	set := bson.M{"status": post.Status}
+	unset := bson.M{}
+
+	for field, value := range map[string]string{
+		"message": post.Message,
+		"title":   post.Title,
+		"body":    post.Body,
+		"excerpt": post.Excerpt,
+		"html":    post.HTML,
+	} {
+		if value == "" {
+			unset[field] = ""
+		} else {
+			set[field] = value
+		}
+	}
+
+	if len(post.Tags) == 0 {
+		unset["tags"] = ""
+	} else {
+		set["tags"] = post.Tags
+	}
+
+	for field, value := range map[string]*time.Time{"publish_at": post.PublishAt, "published_at": post.PublishedAt} {
+		if value == nil {
+			unset[field] = ""
+		} else {
+			set[field] = *value
+		}
+	}
+
+	if post.FanoutPending {
+		set["fanout_pending"] = true
+	}
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	return update
+}
+
+// check if the edit changed the content of the post
+func contentChanged(previous, post models.Post) bool {
+	return previous.Message != post.Message || previous.Title != post.Title ||
+		previous.Body != post.Body || previous.Excerpt != post.Excerpt
+}
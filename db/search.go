@@ -0,0 +1,310 @@
+package db
+
+import (
+	"contacts/models"
+	"contacts/search"
+	"context"
+	"regexp"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// weights of the fields in the text indexes created by GetConnection
+var (
+	postsTextWeights = bson.D{
+		{Key: "title", Value: 10},
+		{Key: "tags", Value: 5},
+		{Key: "message", Value: 5},
+		{Key: "excerpt", Value: 3},
+		{Key: "body", Value: 2},
+		{Key: "comments.content", Value: 1},
+	}
+	usersTextWeights = bson.D{
+		{Key: "username", Value: 10},
+		{Key: "display_name", Value: 5},
+		{Key: "bio", Value: 1},
+	}
+)
+
+// build the text index model of the fields with their weights
+func textIndexModel(weights bson.D) mongo.IndexModel {
+	keys := bson.D{}
+	for _, field := range weights {
+		keys = append(keys, bson.E{Key: field.Key, Value: "text"})
+	}
+
+	return mongo.IndexModel{Keys: keys, Options: options.Index().SetWeights(weights)}
+}
+
+// MongoSearch searches the posts, comments and users with the text indexes of their collections
+type MongoSearch struct {
+	Users CollectionAPI
+	Posts CollectionAPI
+}
+
+// sort of the results by relevance, newest first when there is no text to rank by
+func searchSort(q search.Query) bson.D {
+	if !q.HasText() {
+		return bson.D{{Key: "_id", Value: -1}}
+	}
+
+	return bson.D{{Key: "score", Value: bson.M{"$meta": "textScore"}}, {Key: "_id", Value: -1}}
+}
+
+// Search the published posts the viewer can see
+func (m *MongoSearch) SearchPosts(ctx context.Context, q search.Query, viewer models.User, page models.PageQuery) ([]search.PostHit, string, *echo.HTTPError) {
+	offset, httpErr := pageOffset(page)
+	if httpErr != nil {
+		return nil, "", httpErr
+	}
+
+	hidden, httpErr := HiddenAuthors(ctx, viewer, m.Users)
+	if httpErr != nil {
+		return nil, "", httpErr
+	}
+
+	filter, httpErr := m.postsFilter(ctx, q, viewer, hidden)
+	if httpErr != nil {
+		return nil, "", httpErr
+	}
+
+	opts := options.Find().SetSort(searchSort(q)).SetSkip(int64(offset)).SetLimit(int64(page.Limit) + 1)
+	if q.HasText() {
+		opts.SetProjection(bson.M{"score": bson.M{"$meta": "textScore"}})
+	}
+
+	var found []struct {
+		models.Post `bson:",inline"`
+		Score       float64 `bson:"score"`
+	}
+
+	cursor, err := m.Posts.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, "", echo.NewHTTPError(500, "Unable to search posts")
+	}
+
+	if err = cursor.All(ctx, &found); err != nil {
+		return nil, "", echo.NewHTTPError(500, "Unable to parse found posts")
+	}
+
+	more := len(found) > page.Limit
+	if more {
+		found = found[:page.Limit]
+	}
+
+	hits := make([]search.PostHit, len(found))
+	for i, post := range found {
+		hits[i] = search.PostHit{
+			Post:    post.Post,
+			Score:   post.Score,
+			Snippet: search.BestSnippet(q, post.Title, post.Message, post.Excerpt, post.Body),
+		}
+	}
+
+	return hits, nextOffsetCursor(offset, more, page), nil
+}
+
+// Search the comments the viewer can see, in the posts it can see
+func (m *MongoSearch) SearchComments(ctx context.Context, q search.Query, viewer models.User, page models.PageQuery) ([]search.CommentHit, string, *echo.HTTPError) {
+	offset, httpErr := pageOffset(page)
+	if httpErr != nil {
+		return nil, "", httpErr
+	}
+
+	hidden, httpErr := HiddenAuthors(ctx, viewer, m.Users)
+	if httpErr != nil {
+		return nil, "", httpErr
+	}
+
+	// from: keeps the comments of the user, in posts of anyone
+	filter, httpErr := m.postsFilter(ctx, search.Query{Terms: q.Terms, Phrases: q.Phrases, Tags: q.Tags}, viewer, hidden)
+	if httpErr != nil {
+		return nil, "", httpErr
+	}
+
+	commentFilter := bson.M{"comments.from": bson.M{"$nin": append([]string{}, hidden...)}}
+	if q.From != "" {
+		authorID, httpErr := m.userIDByUsername(ctx, q.From)
+		if httpErr != nil {
+			return nil, "", httpErr
+		}
+		commentFilter["comments.from"] = bson.M{"$nin": append([]string{}, hidden...), "$eq": authorID}
+		filter["comments.from"] = authorID
+	}
+
+	// comments are ranked by the needles they contain, then by the relevance of their post
+	matched := bson.A{}
+	for _, needle := range q.Needles() {
+		pattern := regexp.QuoteMeta(needle)
+		matched = append(matched, bson.M{"$cond": bson.A{
+			bson.M{"$regexMatch": bson.M{"input": "$comments.content", "regex": pattern, "options": "i"}}, 1, 0,
+		}})
+	}
+
+	pipeline := []bson.M{{"$match": filter}}
+	if q.HasText() {
+		pipeline = append(pipeline, bson.M{"$addFields": bson.M{"score": bson.M{"$meta": "textScore"}}})
+	}
+	pipeline = append(pipeline,
+		bson.M{"$unwind": "$comments"},
+		bson.M{"$match": commentFilter},
+		bson.M{"$addFields": bson.M{"matched": bson.M{"$add": append(matched, 0)}}},
+	)
+	if len(matched) > 0 {
+		pipeline = append(pipeline, bson.M{"$match": bson.M{"matched": bson.M{"$gt": 0}}})
+	}
+	pipeline = append(pipeline,
+		bson.M{"$sort": bson.D{{Key: "matched", Value: -1}, {Key: "score", Value: -1}, {Key: "comments._id", Value: -1}}},
+		bson.M{"$skip": offset},
+		bson.M{"$limit": page.Limit + 1},
+		bson.M{"$project": bson.M{"comments": 1, "score": 1, "matched": 1}},
+	)
+
+	var found []struct {
+		PostID  primitive.ObjectID `bson:"_id"`
+		Comment models.Comment     `bson:"comments"`
+		Score   float64            `bson:"score"`
+		Matched int                `bson:"matched"`
+	}
+
+	cursor, err := m.Posts.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, "", echo.NewHTTPError(500, "Unable to search comments")
+	}
+
+	if err = cursor.All(ctx, &found); err != nil {
+		return nil, "", echo.NewHTTPError(500, "Unable to parse found comments")
+	}
+
+	more := len(found) > page.Limit
+	if more {
+		found = found[:page.Limit]
+	}
+
+	hits := make([]search.CommentHit, len(found))
+	for i, comment := range found {
+		snippet, _ := search.Snippet(q, comment.Comment.Content)
+		hits[i] = search.CommentHit{
+			PostID:  comment.PostID.Hex(),
+			Comment: comment.Comment,
+			Score:   float64(comment.Matched) + comment.Score,
+			Snippet: snippet,
+		}
+	}
+
+	return hits, nextOffsetCursor(offset, more, page), nil
+}
+
+// Search the users by username, display name and bio. Users that blocked the viewer
+// and accounts being deleted are left out
+func (m *MongoSearch) SearchUsers(ctx context.Context, q search.Query, viewer models.User, page models.PageQuery) ([]search.UserHit, string, *echo.HTTPError) {
+	if q.From != "" || len(q.Tags) > 0 || !q.HasText() {
+		return nil, "", echo.NewHTTPError(400, "Users are only searched by text")
+	}
+
+	offset, httpErr := pageOffset(page)
+	if httpErr != nil {
+		return nil, "", httpErr
+	}
+
+	blockedBy, httpErr := blockedByIDs(ctx, viewer.ID.Hex(), m.Users)
+	if httpErr != nil {
+		return nil, "", httpErr
+	}
+
+	excluded := []primitive.ObjectID{}
+	for _, id := range blockedBy {
+		if docID, err := primitive.ObjectIDFromHex(id); err == nil {
+			excluded = append(excluded, docID)
+		}
+	}
+
+	filter := bson.M{"$text": bson.M{"$search": q.Text()}, "_id": bson.M{"$nin": excluded}, "deletion_due_at": nil}
+	opts := options.Find().
+		SetSort(searchSort(q)).
+		SetSkip(int64(offset)).
+		SetLimit(int64(page.Limit) + 1).
+		SetProjection(bson.M{"score": bson.M{"$meta": "textScore"}})
+
+	var found []struct {
+		models.User `bson:",inline"`
+		Score       float64 `bson:"score"`
+	}
+
+	cursor, err := m.Users.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, "", echo.NewHTTPError(500, "Unable to search users")
+	}
+
+	if err = cursor.All(ctx, &found); err != nil {
+		return nil, "", echo.NewHTTPError(500, "Unable to parse found users")
+	}
+
+	more := len(found) > page.Limit
+	if more {
+		found = found[:page.Limit]
+	}
+
+	hits := make([]search.UserHit, len(found))
+	for i, user := range found {
+		hits[i] = search.UserHit{
+			PublicProfile: user.PublicProfile(),
+			Score:         user.Score,
+			Snippet:       search.BestSnippet(q, user.Username, user.DisplayName, user.Bio),
+		}
+	}
+
+	return hits, nextOffsetCursor(offset, more, page), nil
+}
+
+// filter of the published posts not hidden to the viewer matching the text and operators of the query
+func (m *MongoSearch) postsFilter(ctx context.Context, q search.Query, viewer models.User, hidden []string) (bson.M, *echo.HTTPError) {
+	filter := publishedFilter()
+	filter["$and"] = bson.A{visibleFilter(viewer, hidden)}
+
+	if q.HasText() {
+		filter["$text"] = bson.M{"$search": q.Text()}
+	}
+
+	if q.From != "" {
+		authorID, httpErr := m.userIDByUsername(ctx, q.From)
+		if httpErr != nil {
+			return nil, httpErr
+		}
+		filter["from"] = authorID
+	}
+
+	if len(q.Tags) > 0 {
+		tags := make([]string, len(q.Tags))
+		for i, tag := range q.Tags {
+			normalized, ok := NormalizeTag(tag)
+			if !ok {
+				return nil, echo.NewHTTPError(400, "Invalid tag")
+			}
+			tags[i] = normalized
+		}
+		filter["tags"] = bson.M{"$all": tags}
+	}
+
+	return filter, nil
+}
+
+// id of the user with the username of a from: operator
+func (m *MongoSearch) userIDByUsername(ctx context.Context, username string) (string, *echo.HTTPError) {
+	var user models.User
+	opts := options.FindOne().SetProjection(bson.M{"_id": 1})
+	err := m.Users.FindOne(ctx, bson.M{"username": username}, opts).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return "", echo.NewHTTPError(404, "User does not exist")
+	}
+
+	if err != nil {
+		return "", echo.NewHTTPError(500, "Unable to decode retrieved user")
+	}
+
+	return user.ID.Hex(), nil
+}
@@ -0,0 +1,169 @@
+package db
+
+import (
+	"contacts/models"
+	"context"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// how old the last activity on a session has to be before it is recorded again
+const sessionSeenInterval = time.Minute
+
+// indexes of the sessions collection. Expired sessions are removed by mongo
+var SessionIndexes = []mongo.IndexModel{
+	{Keys: bson.M{"refresh_hash": 1}},
+	{Keys: bson.M{"used_hashes": 1}},
+	{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "_id", Value: -1}}},
+	{Keys: bson.M{"expires_at": 1}, Options: options.Index().SetExpireAfterSeconds(0)},
+}
+
+// Open a new session for the user on the given device and return it with its first refresh token
+func CreateSession(ctx context.Context, userID, userAgent, ip string, collection CollectionAPI) (models.Session, string, *echo.HTTPError) {
+	var session models.Session
+
+	refreshToken, err := generateToken()
+	if err != nil {
+		return session, "", echo.NewHTTPError(500, "Unable to create refresh token")
+	}
+
+	now := time.Now()
+	session = models.Session{
+		ID:          primitive.NewObjectID(),
+		UserID:      userID,
+		RefreshHash: hashToken(refreshToken),
+		UserAgent:   userAgent,
+		IP:          ip,
+		CreatedAt:   now,
+		LastSeenAt:  now,
+		ExpiresAt:   now.Add(cfg.RefreshTokenTTL),
+	}
+
+	if _, err = collection.InsertOne(ctx, session); err != nil {
+		return session, "", echo.NewHTTPError(500, "Unable to create session")
+	}
+
+	return session, refreshToken, nil
+}
+
+// Exchange a refresh token for a new one. A refresh token can only be used once,
+// if an already rotated token is presented again the whole session is revoked
+func RotateSession(ctx context.Context, refreshToken, ip string, collection CollectionAPI) (models.Session, string, *echo.HTTPError) {
+	var session models.Session
+
+	newToken, err := generateToken()
+	if err != nil {
+		return session, "", echo.NewHTTPError(500, "Unable to create refresh token")
+	}
+
+	hash := hashToken(refreshToken)
+	filter := bson.M{"refresh_hash": hash, "revoked": false, "expires_at": bson.M{"$gt": time.Now()}}
+	update := bson.M{
+		"$set":  bson.M{"refresh_hash": hashToken(newToken), "ip": ip, "last_seen_at": time.Now()},
+		"$push": bson.M{"used_hashes": hash},
+	}
+
+	result := collection.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After))
+	err = result.Decode(&session)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return session, "", echo.NewHTTPError(500, "Unable to decode retrieved session")
+	}
+
+	if err == mongo.ErrNoDocuments {
+		reused := collection.FindOneAndUpdate(ctx, bson.M{"used_hashes": hash}, bson.M{"$set": bson.M{"revoked": true}})
+		if reused.Err() == nil {
+			return session, "", echo.NewHTTPError(401, "Refresh token already used, session revoked")
+		}
+
+		return session, "", echo.NewHTTPError(401, "Invalid or expired refresh token")
+	}
+
+	return session, newToken, nil
+}
+
+// Revoke one session of the user
+func RevokeSession(ctx context.Context, userID, sessionID string, collection CollectionAPI) *echo.HTTPError {
+	docID, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return echo.NewHTTPError(400, "Unable to convert to object id")
+	}
+
+	res, err := collection.UpdateOne(ctx, bson.M{"_id": docID, "user_id": userID}, bson.M{"$set": bson.M{"revoked": true}})
+	if err != nil {
+		return echo.NewHTTPError(500, "Unable to revoke session")
+	}
+
+	if res.MatchedCount == 0 {
+		return echo.NewHTTPError(404, "Session does not exist")
+	}
+
+	return nil
+}
+
+// Revoke every active session of the user except the given one
+func RevokeOtherSessions(ctx context.Context, userID, sessionID string, collection CollectionAPI) (int64, *echo.HTTPError) {
+	docID, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return 0, echo.NewHTTPError(400, "Unable to convert to object id")
+	}
+
+	filter := bson.M{"user_id": userID, "_id": bson.M{"$ne": docID}, "revoked": false}
+	res, err := collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"revoked": true}})
+	if err != nil {
+		return 0, echo.NewHTTPError(500, "Unable to revoke sessions")
+	}
+
+	return res.ModifiedCount, nil
+}
+
+// Revoke every session of the user
+func RevokeUserSessions(ctx context.Context, userID string, collection CollectionAPI) *echo.HTTPError {
+	_, err := collection.UpdateMany(ctx, bson.M{"user_id": userID, "revoked": false}, bson.M{"$set": bson.M{"revoked": true}})
+	if err != nil {
+		return echo.NewHTTPError(500, "Unable to revoke sessions")
+	}
+
+	return nil
+}
+
+// Retrieve a page of the active sessions of the user flagging the one the request comes from
+func ListUserSessions(ctx context.Context, userID, currentID string, query models.PageQuery, collection CollectionAPI) ([]models.Session, string, *echo.HTTPError) {
+	var sessions []models.Session
+
+	filter := bson.M{"user_id": userID, "revoked": false, "expires_at": bson.M{"$gt": time.Now()}}
+	next, httpErr := findPage(ctx, collection, filter, query, &sessions)
+	if httpErr != nil {
+		return nil, "", httpErr
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID.Hex() == currentID
+	}
+
+	return sessions, next, nil
+}
+
+// check if the session is still valid and record the user activity on it, at most once per
+// sessionSeenInterval so requests do not all write to the session
+func IsSessionActive(ctx context.Context, sessionID string, collection CollectionAPI) bool {
+	docID, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return false
+	}
+
+	now := time.Now()
+	filter := bson.M{"_id": docID, "revoked": false, "expires_at": bson.M{"$gt": now}}
+	if err = collection.FindOne(ctx, filter, options.FindOne().SetProjection(bson.M{"_id": 1})).Err(); err != nil {
+		return false
+	}
+
+	// the activity is only informative, the session stays active when it can not be recorded
+	filter["last_seen_at"] = bson.M{"$lt": now.Add(-sessionSeenInterval)}
+	collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"last_seen_at": now}})
+	return true
+}
@@ -0,0 +1,293 @@
+package db
+
+import (
+	"contacts/models"
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// weights of the signals used to rank the follow suggestions
+const (
+	suggestionMutualWeight     = 3.0
+	suggestionFollowsYouWeight = 2.0
+	suggestionPopularityWeight = 1.0
+	suggestionActivityWeight   = 0.5
+	suggestionMaxRecentPosts   = 10
+	suggestionPopularPool      = 100
+	suggestionActivityWindow   = 7 * 24 * time.Hour
+)
+
+// Rank the users the user may want to follow. Candidates are the users followed by the followed users,
+// the followers not followed back and the most followed users, ranked by the overlap with the
+// follows of the user, popularity and recent posting activity
+func GetSuggestions(ctx context.Context, id string, query models.PageQuery, users, posts CollectionAPI) ([]models.Suggestion, string, *echo.HTTPError) {
+	offset, httpErr := pageOffset(query)
+	if httpErr != nil {
+		return nil, "", httpErr
+	}
+
+	user, httpErr := FindUser(ctx, id, users)
+	if httpErr != nil {
+		return nil, "", httpErr
+	}
+
+	excluded, httpErr := suggestionExclusions(ctx, user, users)
+	if httpErr != nil {
+		return nil, "", httpErr
+	}
+
+	mutuals, httpErr := friendsOfFriends(ctx, user, users)
+	if httpErr != nil {
+		return nil, "", httpErr
+	}
+
+	candidateIDs := []primitive.ObjectID{}
+	for candidateID := range mutuals {
+		if docID, err := primitive.ObjectIDFromHex(candidateID); err == nil && !excluded[candidateID] {
+			candidateIDs = append(candidateIDs, docID)
+		}
+	}
+	for _, followerID := range user.Followers {
+		if docID, err := primitive.ObjectIDFromHex(followerID); err == nil && !excluded[followerID] {
+			candidateIDs = append(candidateIDs, docID)
+		}
+	}
+
+	excludedIDs := make([]primitive.ObjectID, 0, len(excluded))
+	for excludedID := range excluded {
+		if docID, err := primitive.ObjectIDFromHex(excludedID); err == nil {
+			excludedIDs = append(excludedIDs, docID)
+		}
+	}
+
+	popular, httpErr := popularIDs(ctx, excludedIDs, users)
+	if httpErr != nil {
+		return nil, "", httpErr
+	}
+
+	filter := bson.M{
+		"_id":             bson.M{"$nin": excludedIDs},
+		"deletion_due_at": nil,
+		"$or": []bson.M{
+			{"_id": bson.M{"$in": candidateIDs}},
+			{"_id": bson.M{"$in": popular}},
+		},
+	}
+
+	var candidates []models.User
+	cursor, err := users.Find(ctx, filter)
+	if err != nil {
+		return nil, "", echo.NewHTTPError(404, "Unable to find users")
+	}
+
+	if err = cursor.All(ctx, &candidates); err != nil {
+		return nil, "", echo.NewHTTPError(500, "Unable to parse retrieved users")
+	}
+
+	activity, httpErr := recentPostCounts(ctx, candidates, posts)
+	if httpErr != nil {
+		return nil, "", httpErr
+	}
+
+	suggestions := make([]models.Suggestion, len(candidates))
+	for i, candidate := range candidates {
+		suggestion := models.Suggestion{
+			PublicProfile: candidate.PublicProfile(),
+			MutualFollows: mutuals[candidate.ID.Hex()],
+			FollowsYou:    contains(user.Followers, candidate.ID.Hex()),
+			RecentPosts:   activity[candidate.ID.Hex()],
+		}
+		suggestion.Score = scoreSuggestion(suggestion)
+		suggestions[i] = suggestion
+	}
+
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Score != suggestions[j].Score {
+			return suggestions[i].Score > suggestions[j].Score
+		}
+		return suggestions[i].ID.Hex() > suggestions[j].ID.Hex()
+	})
+
+	if offset >= len(suggestions) {
+		return []models.Suggestion{}, "", nil
+	}
+
+	end := offset + query.Limit
+	more := end < len(suggestions)
+	if !more {
+		end = len(suggestions)
+	}
+
+	return suggestions[offset:end], nextOffsetCursor(offset, more, query), nil
+}
+
+// Stop suggesting the given user to the user
+func DismissSuggestion(ctx context.Context, id, dismissedID string, collection CollectionAPI) *echo.HTTPError {
+	user, httpErr := FindUser(ctx, id, collection)
+	if httpErr != nil {
+		return httpErr
+	}
+
+	if _, httpErr = FindUser(ctx, dismissedID, collection); httpErr != nil {
+		return httpErr
+	}
+
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$addToSet": bson.M{"dismissed_suggestions": dismissedID}})
+	if err != nil {
+		return echo.NewHTTPError(500, "Unable to update user")
+	}
+
+	return nil
+}
+
+// ids that must never be suggested: the user itself, followed, requested, blocked, blocking and dismissed users
+func suggestionExclusions(ctx context.Context, user models.User, collection CollectionAPI) (map[string]bool, *echo.HTTPError) {
+	blockedBy, httpErr := blockedByIDs(ctx, user.ID.Hex(), collection)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+
+	var requested []models.User
+	opts := options.Find().SetProjection(bson.M{"_id": 1})
+	cursor, err := collection.Find(ctx, bson.M{"follow_requests": user.ID.Hex()}, opts)
+	if err != nil {
+		return nil, echo.NewHTTPError(404, "Unable to find users")
+	}
+
+	if err = cursor.All(ctx, &requested); err != nil {
+		return nil, echo.NewHTTPError(500, "Unable to parse retrieved users")
+	}
+
+	excluded := map[string]bool{user.ID.Hex(): true}
+	for _, list := range [][]string{user.Following, user.Blocked, user.Dismissed, blockedBy} {
+		for _, id := range list {
+			excluded[id] = true
+		}
+	}
+	for _, requestedUser := range requested {
+		excluded[requestedUser.ID.Hex()] = true
+	}
+
+	return excluded, nil
+}
+
+// count for every user followed by the followed users how many of them follow it
+func friendsOfFriends(ctx context.Context, user models.User, collection CollectionAPI) (map[string]int, *echo.HTTPError) {
+	mutuals := map[string]int{}
+	if len(user.Following) == 0 {
+		return mutuals, nil
+	}
+
+	followingIDs := make([]primitive.ObjectID, 0, len(user.Following))
+	for _, id := range user.Following {
+		if docID, err := primitive.ObjectIDFromHex(id); err == nil {
+			followingIDs = append(followingIDs, docID)
+		}
+	}
+
+	var followed []models.User
+	opts := options.Find().SetProjection(bson.M{"following": 1})
+	cursor, err := collection.Find(ctx, bson.M{"_id": bson.M{"$in": followingIDs}}, opts)
+	if err != nil {
+		return nil, echo.NewHTTPError(404, "Unable to find users")
+	}
+
+	if err = cursor.All(ctx, &followed); err != nil {
+		return nil, echo.NewHTTPError(500, "Unable to parse retrieved users")
+	}
+
+	for _, followedUser := range followed {
+		for _, id := range followedUser.Following {
+			mutuals[id]++
+		}
+	}
+
+	return mutuals, nil
+}
+
+// ids of the most followed users not excluded, so new users without follows get suggestions too
+func popularIDs(ctx context.Context, excludedIDs []primitive.ObjectID, collection CollectionAPI) ([]primitive.ObjectID, *echo.HTTPError) {
+	var popular []models.User
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "followers_count", Value: -1}, {Key: "_id", Value: 1}}).
+		SetLimit(suggestionPopularPool).
+		SetProjection(bson.M{"_id": 1})
+	cursor, err := collection.Find(ctx, bson.M{"_id": bson.M{"$nin": excludedIDs}}, opts)
+	if err != nil {
+		return nil, echo.NewHTTPError(404, "Unable to find users")
+	}
+
+	if err = cursor.All(ctx, &popular); err != nil {
+		return nil, echo.NewHTTPError(500, "Unable to parse retrieved users")
+	}
+
+	ids := make([]primitive.ObjectID, len(popular))
+	for i, user := range popular {
+		ids[i] = user.ID
+	}
+
+	return ids, nil
+}
+
+// count the posts published by every candidate within the activity window
+func recentPostCounts(ctx context.Context, candidates []models.User, collection CollectionAPI) (map[string]int, *echo.HTTPError) {
+	ids := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		ids[i] = candidate.ID.Hex()
+	}
+
+	since := primitive.NewObjectIDFromTimestamp(time.Now().Add(-suggestionActivityWindow))
+	match := publishedFilter()
+	match["from"] = bson.M{"$in": ids}
+	match["_id"] = bson.M{"$gte": since}
+	pipeline := []bson.M{
+		{"$match": match},
+		{"$group": bson.M{"_id": "$from", "count": bson.M{"$sum": 1}}},
+	}
+
+	var counts []struct {
+		From  string `bson:"_id"`
+		Count int    `bson:"count"`
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, echo.NewHTTPError(500, "Unable to count recent posts")
+	}
+
+	if err = cursor.All(ctx, &counts); err != nil {
+		return nil, echo.NewHTTPError(500, "Unable to parse recent posts count")
+	}
+
+	activity := make(map[string]int, len(counts))
+	for _, count := range counts {
+		activity[count.From] = count.Count
+	}
+
+	return activity, nil
+}
+
+// combine the signals of the suggestion into its ranking score
+func scoreSuggestion(s models.Suggestion) float64 {
+	score := suggestionMutualWeight * float64(s.MutualFollows)
+	if s.FollowsYou {
+		score += suggestionFollowsYouWeight
+	}
+
+	score += suggestionPopularityWeight * math.Log1p(float64(s.FollowersCount))
+	recentPosts := s.RecentPosts
+	if recentPosts > suggestionMaxRecentPosts {
+		recentPosts = suggestionMaxRecentPosts
+	}
+	score += suggestionActivityWeight * float64(recentPosts)
+
+	return score
+}
@@ -0,0 +1,162 @@
+package db
+
+import (
+	"contacts/models"
+	"context"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// a hashtag starts the text or follows a character that can not be part of a word, an url or an html entity
+	hashtagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_&/#])#([\p{L}\p{N}_-]+)`)
+	tagPattern     = regexp.MustCompile(`^[\p{L}\p{N}_-]+$`)
+)
+
+// Normalize the tag to its stored form: lowercase without the leading #.
+// Return false if the tag is empty, too long or has invalid characters
+func NormalizeTag(tag string) (string, bool) {
+	tag = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+	if !tagPattern.MatchString(tag) || utf8.RuneCountInString(tag) > models.MaxTagLength {
+		return "", false
+	}
+
+	return tag, true
+}
+
+// normalize the tags given to the post and add the hashtags of its message and body
+// until the limit of tags is reached
+func tagPost(post *models.Post) *echo.HTTPError {
+	tags := []string{}
+	for _, tag := range post.Tags {
+		normalized, ok := NormalizeTag(tag)
+		if !ok {
+			return echo.NewHTTPError(400, "Invalid tag "+tag)
+		}
+		if !contains(tags, normalized) {
+			tags = append(tags, normalized)
+		}
+	}
+
+	if len(tags) > models.MaxTags {
+		return echo.NewHTTPError(400, "Too many tags")
+	}
+
+	for _, text := range []string{post.Message, post.Body} {
+		for _, match := range hashtagPattern.FindAllStringSubmatch(text, -1) {
+			normalized, ok := NormalizeTag(match[1])
+			if ok && len(tags) < models.MaxTags && !contains(tags, normalized) {
+				tags = append(tags, normalized)
+			}
+		}
+	}
+
+	post.Tags = tags
+	return nil
+}
+
+// Retrieve a page of the published posts with the tag, latest published first, leaving out the hidden authors
+func FindTagPosts(ctx context.Context, tag string, viewer models.User, hidden []string, query models.PageQuery, collection CollectionAPI) ([]models.Post, string, *echo.HTTPError) {
+	var posts []models.Post
+
+	filter := publishedFilter()
+	filter["tags"] = tag
+	filter["$and"] = bson.A{visibleFilter(viewer, hidden)}
+
+	next, httpErr := findPublishedPage(ctx, collection, filter, query, &posts)
+	return posts, next, httpErr
+}
+
+// Retrieve a page of the tags used by the published posts, most used first
+func ListTags(ctx context.Context, query models.PageQuery, collection CollectionAPI) ([]models.TagCount, string, *echo.HTTPError) {
+	tags := []models.TagCount{}
+
+	offset, httpErr := pageOffset(query)
+	if httpErr != nil {
+		return nil, "", httpErr
+	}
+
+	pipeline := []bson.M{
+		{"$match": publishedFilter()},
+		{"$unwind": "$tags"},
+		{"$group": bson.M{"_id": "$tags", "count": bson.M{"$sum": 1}}},
+		{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}},
+		{"$skip": offset},
+		{"$limit": query.Limit + 1},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, "", echo.NewHTTPError(500, "Unable to count tags")
+	}
+
+	if err = cursor.All(ctx, &tags); err != nil {
+		return nil, "", echo.NewHTTPError(500, "Unable to parse retrieved tags")
+	}
+
+	more := len(tags) > query.Limit
+	if more {
+		tags = tags[:query.Limit]
+	}
+
+	return tags, nextOffsetCursor(offset, more, query), nil
+}
+
+// Retrieve a page of the tags followed by the user, in the order they were followed
+func GetFollowedTags(ctx context.Context, userID string, query models.PageQuery, collection CollectionAPI) ([]string, string, *echo.HTTPError) {
+	var user models.User
+
+	offset, httpErr := pageOffset(query)
+	if httpErr != nil {
+		return nil, "", httpErr
+	}
+
+	docID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, "", echo.NewHTTPError(400, "Unable to convert to object id")
+	}
+
+	opts := options.FindOne().SetProjection(bson.M{"followed_tags": bson.M{"$slice": bson.A{offset, query.Limit + 1}}})
+	err = collection.FindOne(ctx, bson.M{"_id": docID}, opts).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, "", echo.NewHTTPError(404, "User does not exist")
+	}
+
+	if err != nil {
+		return nil, "", echo.NewHTTPError(500, "Unable to decode retrieved user")
+	}
+
+	tags := append([]string{}, user.FollowedTags...)
+	more := len(tags) > query.Limit
+	if more {
+		tags = tags[:query.Limit]
+	}
+
+	return tags, nextOffsetCursor(offset, more, query), nil
+}
+
+// Follow or unfollow the tag for the user. Return whether it is followed now
+func ToggleTagFollow(ctx context.Context, userID, tag string, collection CollectionAPI) (bool, *echo.HTTPError) {
+	user, httpErr := FindUser(ctx, userID, collection)
+	if httpErr != nil {
+		return false, httpErr
+	}
+
+	op := "$addToSet"
+	if contains(user.FollowedTags, tag) {
+		op = "$pull"
+	}
+
+	if _, err := collection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{op: bson.M{"followed_tags": tag}}); err != nil {
+		return false, echo.NewHTTPError(500, "Unable to update user")
+	}
+
+	return op == "$addToSet", nil
+}
@@ -0,0 +1,127 @@
+package db
+
+import (
+	"contacts/models"
+	"context"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// indexes of the login attempts collection. Old attempts are removed by mongo
+var LoginAttemptIndexes = []mongo.IndexModel{
+	{Keys: bson.D{{Key: "username", Value: 1}, {Key: "_id", Value: -1}}},
+	{Keys: bson.D{{Key: "ip", Value: 1}, {Key: "_id", Value: -1}}},
+	{Keys: bson.M{"expires_at": 1}, Options: options.Index().SetExpireAfterSeconds(0)},
+}
+
+// Get how long the caller must wait before trying to login again, the longest wait of the given throttles
+func CheckLoginThrottle(ctx context.Context, keys []string, collection CollectionAPI) (time.Duration, *echo.HTTPError) {
+	var throttles []models.LoginThrottle
+
+	cursor, err := collection.Find(ctx, bson.M{"_id": bson.M{"$in": keys}, "blocked_until": bson.M{"$gt": time.Now()}})
+	if err != nil {
+		return 0, echo.NewHTTPError(500, "Unable to find login throttles")
+	}
+
+	if err = cursor.All(ctx, &throttles); err != nil {
+		return 0, echo.NewHTTPError(500, "Unable to parse retrieved login throttles")
+	}
+
+	var wait time.Duration
+	for _, throttle := range throttles {
+		if remaining := time.Until(throttle.BlockedUntil); remaining > wait {
+			wait = remaining
+		}
+	}
+
+	return wait, nil
+}
+
+// Count a failed login for the throttle and block it with an exponential backoff, up to
+// LOGIN_MAX_BACKOFF until the threshold is reached. From there the backoff starts from the
+// lockout time. Failures older than the failure window are forgotten
+func RegisterLoginFailure(ctx context.Context, key string, threshold int, collection CollectionAPI) *echo.HTTPError {
+	var throttle models.LoginThrottle
+
+	now := time.Now()
+	stale := bson.M{"_id": key, "updated_at": bson.M{"$lt": now.Add(-cfg.LoginFailureWindow)}}
+	if _, err := collection.UpdateOne(ctx, stale, bson.M{"$set": bson.M{"failures": 0}}); err != nil {
+		return echo.NewHTTPError(500, "Unable to update login throttle")
+	}
+
+	// failures counted at once so parallel attempts are all counted
+	update := bson.M{"$inc": bson.M{"failures": 1}, "$set": bson.M{"updated_at": now}}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	if err := collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, update, opts).Decode(&throttle); err != nil {
+		return echo.NewHTTPError(500, "Unable to update login throttle")
+	}
+
+	block := bson.M{"$max": bson.M{"blocked_until": now.Add(loginBackoff(throttle.Failures, threshold))}}
+	if _, err := collection.UpdateOne(ctx, bson.M{"_id": key}, block); err != nil {
+		return echo.NewHTTPError(500, "Unable to update login throttle")
+	}
+
+	return nil
+}
+
+// compute the time to block the throttle after the given amount of consecutive failures
+func loginBackoff(failures, threshold int) time.Duration {
+	base, exponent, max := cfg.LoginBackoffBase, failures-1, cfg.LoginMaxBackoff
+	if failures >= threshold {
+		base, exponent, max = cfg.LoginLockout, failures-threshold, cfg.LoginMaxLockout
+	}
+
+	backoff := base
+	for i := 0; i < exponent && backoff < max; i++ {
+		backoff *= 2
+	}
+
+	if backoff > max {
+		return max
+	}
+
+	return backoff
+}
+
+// Forget the failures of the throttle, after a successful login or an admin unlock
+func ResetLoginThrottle(ctx context.Context, key string, collection CollectionAPI) *echo.HTTPError {
+	if _, err := collection.DeleteOne(ctx, bson.M{"_id": key}); err != nil {
+		return echo.NewHTTPError(500, "Unable to reset login throttle")
+	}
+
+	return nil
+}
+
+// insert the login attempt in the db
+func RecordLoginAttempt(ctx context.Context, attempt models.LoginAttempt, collection CollectionAPI) *echo.HTTPError {
+	attempt.ID = primitive.NewObjectID()
+	attempt.CreatedAt = time.Now()
+	attempt.ExpiresAt = attempt.CreatedAt.Add(cfg.LoginAttemptsRetention)
+
+	if _, err := collection.InsertOne(ctx, attempt); err != nil {
+		return echo.NewHTTPError(500, "Unable to record login attempt")
+	}
+
+	return nil
+}
+
+// Retrieve the latest login attempts, optionally filtered by username and ip
+func ListLoginAttempts(ctx context.Context, username, ip string, query models.PageQuery, collection CollectionAPI) ([]models.LoginAttempt, string, *echo.HTTPError) {
+	var attempts []models.LoginAttempt
+
+	filter := bson.M{}
+	if username != "" {
+		filter["username"] = username
+	}
+	if ip != "" {
+		filter["ip"] = ip
+	}
+
+	next, httpErr := findPage(ctx, collection, filter, query, &attempts)
+	return attempts, next, httpErr
+}
@@ -0,0 +1,441 @@
+package db
+
+import (
+	"bytes"
+	"contacts/models"
+	"context"
+	"sort"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// amount of timeline entries inserted at once by the fan-out
+const fanoutBatchSize = 1000
+
+// indexes of the timelines collection. A post is delivered once to every timeline, which
+// is read latest published first. Entries are removed by post and by followed author
+var TimelineIndexes = []mongo.IndexModel{
+	{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "post_id", Value: -1}}, Options: options.Index().SetUnique(true)},
+	{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "published_at", Value: -1}, {Key: "post_id", Value: -1}}},
+	{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "author_id", Value: 1}}},
+	{Keys: bson.M{"author_id": 1}},
+	{Keys: bson.M{"post_id": 1}},
+}
+
+// Get a page of the home timeline of the user. Posts of followed users are read from the timeline
+// filled by the fan-out, while posts of followed users with too many followers to fan out and posts
+// of followed tags are pulled from the posts at read time. Posts of tags leave out the hidden authors.
+// Both are merged latest published first
+func ReadTimeline(ctx context.Context, user models.User, hidden []string, query models.PageQuery, users, posts, timelines CollectionAPI) ([]models.Post, string, *echo.HTTPError) {
+	cursor, httpErr := decodeCursor(query)
+	if httpErr != nil {
+		return nil, "", httpErr
+	}
+
+	if cursor.After != nil && cursor.Published == nil {
+		return nil, "", echo.NewHTTPError(400, "Invalid cursor")
+	}
+
+	delivered, httpErr := timelineEntries(ctx, user, cursor, query, timelines)
+	if httpErr != nil {
+		return nil, "", httpErr
+	}
+
+	pulled, httpErr := pullTimelinePosts(ctx, user, hidden, cursor, query, users, posts)
+	if httpErr != nil {
+		return nil, "", httpErr
+	}
+
+	found := make(map[primitive.ObjectID]models.Post, len(pulled))
+	entries := []models.TimelineEntry{}
+	for _, post := range pulled {
+		found[post.ID] = post
+		entries = append(entries, models.NewTimelineEntry(user.ID.Hex(), post))
+	}
+	for _, entry := range delivered {
+		if _, ok := found[entry.PostID]; !ok {
+			entries = append(entries, entry)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].PublishedAt.Equal(entries[j].PublishedAt) {
+			return entries[i].PublishedAt.After(entries[j].PublishedAt)
+		}
+		return bytes.Compare(entries[i].PostID[:], entries[j].PostID[:]) > 0
+	})
+
+	next := ""
+	if len(entries) > query.Limit {
+		entries = entries[:query.Limit]
+		last := entries[len(entries)-1]
+		next = encodeCursor(pageCursor{After: &last.PostID, Published: &last.PublishedAt})
+	}
+
+	missing := []primitive.ObjectID{}
+	for _, entry := range entries {
+		if _, ok := found[entry.PostID]; !ok {
+			missing = append(missing, entry.PostID)
+		}
+	}
+
+	if len(missing) > 0 {
+		var deliveredPosts []models.Post
+		filter := publishedFilter()
+		filter["_id"] = bson.M{"$in": missing}
+
+		result, err := posts.Find(ctx, filter)
+		if err != nil {
+			return nil, "", echo.NewHTTPError(404, "Unable to find posts")
+		}
+
+		if err = result.All(ctx, &deliveredPosts); err != nil {
+			return nil, "", echo.NewHTTPError(500, "Unable to parse retrieved posts")
+		}
+
+		for _, post := range deliveredPosts {
+			found[post.ID] = post
+		}
+	}
+
+	// entries of posts deleted or unpublished since the fan-out are left out
+	page := make([]models.Post, 0, len(entries))
+	for _, entry := range entries {
+		if post, ok := found[entry.PostID]; ok {
+			page = append(page, post)
+		}
+	}
+
+	return page, next, nil
+}
+
+// entries of the timeline of the user after the cursor, without muted users
+func timelineEntries(ctx context.Context, user models.User, cursor pageCursor, query models.PageQuery, timelines CollectionAPI) ([]models.TimelineEntry, *echo.HTTPError) {
+	filter := bson.M{"user_id": user.ID.Hex(), "author_id": bson.M{"$nin": append([]string{}, user.Muted...)}}
+	if cursor.After != nil {
+		filter["$and"] = bson.A{publishedAfter(cursor, "published_at", "post_id")}
+	}
+
+	var entries []models.TimelineEntry
+	order := bson.D{{Key: "published_at", Value: -1}, {Key: "post_id", Value: -1}}
+	opts := options.Find().SetSort(order).SetLimit(int64(query.Limit) + 1).SetProjection(bson.M{"post_id": 1, "published_at": 1})
+	result, err := timelines.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, echo.NewHTTPError(404, "Unable to find timeline")
+	}
+
+	if err = result.All(ctx, &entries); err != nil {
+		return nil, echo.NewHTTPError(500, "Unable to parse retrieved timeline")
+	}
+
+	return entries, nil
+}
+
+// posts after the cursor of the followed users that are not fanned out and of the followed tags
+func pullTimelinePosts(ctx context.Context, user models.User, hidden []string, cursor pageCursor, query models.PageQuery, users, posts CollectionAPI) ([]models.Post, *echo.HTTPError) {
+	pulledAuthors, httpErr := pulledAuthors(ctx, user, users)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+
+	sources := bson.A{}
+	if len(pulledAuthors) > 0 {
+		sources = append(sources, bson.M{"from": bson.M{"$in": pulledAuthors}})
+	}
+	if len(user.FollowedTags) > 0 {
+		sources = append(sources, bson.M{"tags": bson.M{"$in": user.FollowedTags}, "$and": bson.A{visibleFilter(user, hidden)}})
+	}
+
+	if len(sources) == 0 {
+		return []models.Post{}, nil
+	}
+
+	filter := publishedFilter()
+	filter["$or"] = sources
+	if cursor.After != nil {
+		filter["$and"] = bson.A{publishedAfter(cursor, "published_at", "_id")}
+	}
+
+	var pulled []models.Post
+	order := bson.D{{Key: "published_at", Value: -1}, {Key: "_id", Value: -1}}
+	opts := options.Find().SetSort(order).SetLimit(int64(query.Limit) + 1)
+	result, err := posts.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, echo.NewHTTPError(404, "Unable to find posts")
+	}
+
+	if err = result.All(ctx, &pulled); err != nil {
+		return nil, echo.NewHTTPError(500, "Unable to parse retrieved posts")
+	}
+
+	return pulled, nil
+}
+
+// followed users, not muted, with more followers than the fan-out delivers to
+func pulledAuthors(ctx context.Context, user models.User, collection CollectionAPI) ([]string, *echo.HTTPError) {
+	followingIDs := []primitive.ObjectID{}
+	for _, id := range user.Following {
+		if docID, err := primitive.ObjectIDFromHex(id); err == nil && !contains(user.Muted, id) {
+			followingIDs = append(followingIDs, docID)
+		}
+	}
+
+	if len(followingIDs) == 0 {
+		return []string{}, nil
+	}
+
+	pipeline := []bson.M{
+		{"$match": bson.M{"_id": bson.M{"$in": followingIDs}}},
+		{"$project": bson.M{"followers_count": bson.M{"$size": bson.M{"$ifNull": bson.A{"$followers", bson.A{}}}}}},
+		{"$match": bson.M{"followers_count": bson.M{"$gt": cfg.FanoutMaxFollowers}}},
+	}
+
+	var authors []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+
+	result, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, echo.NewHTTPError(500, "Unable to find followed users")
+	}
+
+	if err = result.All(ctx, &authors); err != nil {
+		return nil, echo.NewHTTPError(500, "Unable to parse followed users")
+	}
+
+	ids := make([]string, len(authors))
+	for i, author := range authors {
+		ids[i] = author.ID.Hex()
+	}
+
+	return ids, nil
+}
+
+// check if the posts of the user are pulled at read time instead of fanned out to its followers
+func isPulledAuthor(user models.User) bool {
+	return len(user.Followers) > cfg.FanoutMaxFollowers
+}
+
+// Ask the fan-out worker to fill the timeline of a user that never had one with the recent posts
+// of its follows. Until then the feed is built from the posts
+func RequestTimelineRebuild(ctx context.Context, user models.User, collection CollectionAPI) *echo.HTTPError {
+	if user.TimelineRebuild {
+		return nil
+	}
+
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"timeline_rebuild": true}})
+	if err != nil {
+		return echo.NewHTTPError(500, "Unable to update user")
+	}
+
+	return nil
+}
+
+// Claim one published post waiting to be fanned out, locking it for the given time
+// so other instances leave it alone. Return false if there is none
+func ClaimPendingFanout(ctx context.Context, lock time.Duration, collection CollectionAPI) (models.Post, bool, error) {
+	var post models.Post
+
+	now := time.Now()
+	filter := bson.M{
+		"fanout_pending": true,
+		"$or":            bson.A{bson.M{"fanout_lock": nil}, bson.M{"fanout_lock": bson.M{"$lt": now}}},
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	result := collection.FindOneAndUpdate(ctx, filter, bson.M{"$set": bson.M{"fanout_lock": now.Add(lock)}}, opts)
+	err := result.Decode(&post)
+	if err == mongo.ErrNoDocuments {
+		return post, false, nil
+	}
+
+	if err != nil {
+		return post, false, err
+	}
+
+	return post, true, nil
+}
+
+// Deliver the claimed post to the timelines of its author and its followers. Authors with too many
+// followers only get it in their own timeline, their posts are pulled by the followers at read time
+func FanOutPost(ctx context.Context, post models.Post, users, posts, timelines CollectionAPI) error {
+	author, httpErr := FindUser(ctx, post.From, users)
+	if httpErr != nil && httpErr.Code != 404 {
+		return httpErr
+	}
+
+	if httpErr == nil && IsPublished(post) && post.DeletedAt == nil {
+		recipients := []string{post.From}
+		if !isPulledAuthor(author) {
+			recipients = append(recipients, author.Followers...)
+		}
+
+		for start := 0; start < len(recipients); start += fanoutBatchSize {
+			end := start + fanoutBatchSize
+			if end > len(recipients) {
+				end = len(recipients)
+			}
+
+			entries := make([]interface{}, 0, end-start)
+			for _, userID := range recipients[start:end] {
+				entries = append(entries, models.NewTimelineEntry(userID, post))
+			}
+
+			if err := insertTimelineEntries(ctx, entries, timelines); err != nil {
+				return err
+			}
+		}
+	}
+
+	// the lock is checked so a post marked again while it was fanned out is claimed once more
+	filter := bson.M{"_id": post.ID, "fanout_lock": post.FanoutLock}
+	_, err := posts.UpdateOne(ctx, filter, bson.M{"$unset": bson.M{"fanout_pending": "", "fanout_lock": ""}})
+	return err
+}
+
+// Claim one user whose timeline has to be rebuilt or filled with the posts of new follows,
+// locking it for the given time so other instances leave it alone. Return false if there is none
+func ClaimTimelineBackfill(ctx context.Context, lock time.Duration, collection CollectionAPI) (models.User, bool, error) {
+	var user models.User
+
+	now := time.Now()
+	filter := bson.M{"$and": bson.A{
+		bson.M{"$or": bson.A{bson.M{"timeline_rebuild": true}, bson.M{"timeline_backfill": bson.M{"$exists": true}}}},
+		bson.M{"$or": bson.A{bson.M{"timeline_lock": nil}, bson.M{"timeline_lock": bson.M{"$lt": now}}}},
+	}}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	result := collection.FindOneAndUpdate(ctx, filter, bson.M{"$set": bson.M{"timeline_lock": now.Add(lock)}}, opts)
+	err := result.Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return user, false, nil
+	}
+
+	if err != nil {
+		return user, false, err
+	}
+
+	return user, true, nil
+}
+
+// Deliver the recent posts of the new follows of the claimed user to its timeline, or of every
+// follow and its own when the timeline is rebuilt. Follows added meanwhile are left for the next claim
+func BackfillTimeline(ctx context.Context, user models.User, users, posts, timelines CollectionAPI) error {
+	userID := user.ID.Hex()
+
+	authors := user.TimelineBackfill
+	if user.TimelineRebuild {
+		authors = append([]string{userID}, user.Following...)
+	}
+
+	for _, authorID := range authors {
+		if authorID != userID && !contains(user.Following, authorID) {
+			continue
+		}
+
+		if err := backfillAuthor(ctx, userID, authorID, users, posts, timelines); err != nil {
+			return err
+		}
+	}
+
+	update := bson.M{
+		"$pull":  bson.M{"timeline_backfill": bson.M{"$in": append([]string{}, user.TimelineBackfill...)}},
+		"$unset": bson.M{"timeline_lock": ""},
+	}
+	if user.TimelineRebuild {
+		update["$set"] = bson.M{"timeline_ready": true}
+		update["$unset"] = bson.M{"timeline_lock": "", "timeline_rebuild": ""}
+	}
+
+	if _, err := users.UpdateOne(ctx, bson.M{"_id": user.ID, "timeline_lock": user.TimelineLock}, update); err != nil {
+		return err
+	}
+
+	_, err := users.UpdateOne(ctx, bson.M{"_id": user.ID, "timeline_backfill": bson.M{"$size": 0}}, bson.M{"$unset": bson.M{"timeline_backfill": ""}})
+	return err
+}
+
+// deliver the recent posts of the author to the timeline of the user, unless they are pulled at read time
+func backfillAuthor(ctx context.Context, userID, authorID string, users, posts, timelines CollectionAPI) error {
+	if authorID != userID {
+		author, httpErr := FindUser(ctx, authorID, users)
+		if httpErr != nil && httpErr.Code != 404 {
+			return httpErr
+		}
+
+		if httpErr != nil || isPulledAuthor(author) {
+			return nil
+		}
+	}
+
+	var recent []models.Post
+	filter := publishedFilter()
+	filter["from"] = authorID
+	order := bson.D{{Key: "published_at", Value: -1}, {Key: "_id", Value: -1}}
+	projection := bson.M{"_id": 1, "from": 1, "published_at": 1}
+	opts := options.Find().SetSort(order).SetLimit(int64(cfg.TimelineBackfillPosts)).SetProjection(projection)
+
+	result, err := posts.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+
+	if err = result.All(ctx, &recent); err != nil {
+		return err
+	}
+
+	if len(recent) == 0 {
+		return nil
+	}
+
+	entries := make([]interface{}, len(recent))
+	for i, post := range recent {
+		entries[i] = models.NewTimelineEntry(userID, post)
+	}
+
+	return insertTimelineEntries(ctx, entries, timelines)
+}
+
+// insert the entries ignoring the ones already delivered, so the fan-out can be retried
+func insertTimelineEntries(ctx context.Context, entries []interface{}, timelines CollectionAPI) error {
+	_, err := timelines.InsertMany(ctx, entries, options.InsertMany().SetOrdered(false))
+	if bulkErr, ok := err.(mongo.BulkWriteException); ok && bulkErr.WriteConcernError == nil {
+		for _, writeErr := range bulkErr.WriteErrors {
+			if writeErr.Code != 11000 {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	return err
+}
+
+// Remove the post from every timeline
+func RemoveTimelinePost(ctx context.Context, id string, timelines CollectionAPI) *echo.HTTPError {
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return echo.NewHTTPError(400, "Unable to convert to object id")
+	}
+
+	if _, err = timelines.DeleteMany(ctx, bson.M{"post_id": docID}); err != nil {
+		return echo.NewHTTPError(500, "Unable to update timelines")
+	}
+
+	return nil
+}
+
+// Remove the posts of the author from the timeline of the user, once it stops following it
+func RemoveTimelineAuthor(ctx context.Context, userID, authorID string, timelines CollectionAPI) *echo.HTTPError {
+	if _, err := timelines.DeleteMany(ctx, bson.M{"user_id": userID, "author_id": authorID}); err != nil {
+		return echo.NewHTTPError(500, "Unable to update timeline")
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package db
+
+import (
+	"contacts/models"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// indexes of the personal access tokens collection
+var AccessTokenIndexes = []mongo.IndexModel{
+	{Keys: bson.M{"token_hash": 1}, Options: options.Index().SetUnique(true)},
+	{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "_id", Value: -1}}},
+}
+
+// Create a personal access token for the user. The token is only returned here
+func CreateAccessToken(ctx context.Context, userID string, req models.NewAccessToken, collection CollectionAPI) (models.AccessToken, string, *echo.HTTPError) {
+	var accessToken models.AccessToken
+
+	secret, err := generateToken()
+	if err != nil {
+		return accessToken, "", echo.NewHTTPError(500, "Unable to create token")
+	}
+	token := models.AccessTokenPrefix + secret
+
+	accessToken = models.AccessToken{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Name:      req.Name,
+		Scopes:    req.Scopes,
+		TokenHash: hashToken(token),
+		CreatedAt: time.Now(),
+	}
+
+	if req.ExpiresInDays > 0 {
+		expiresAt := accessToken.CreatedAt.AddDate(0, 0, req.ExpiresInDays)
+		accessToken.ExpiresAt = &expiresAt
+	}
+
+	if _, err = collection.InsertOne(ctx, accessToken); err != nil {
+		return accessToken, "", echo.NewHTTPError(500, "Unable to create token")
+	}
+
+	return accessToken, token, nil
+}
+
+// Retrieve a page of the personal access tokens of the user
+func ListAccessTokens(ctx context.Context, userID string, query models.PageQuery, collection CollectionAPI) ([]models.AccessToken, string, *echo.HTTPError) {
+	var tokens []models.AccessToken
+
+	next, httpErr := findPage(ctx, collection, bson.M{"user_id": userID, "revoked": false}, query, &tokens)
+	return tokens, next, httpErr
+}
+
+// Revoke one personal access token of the user
+func RevokeAccessToken(ctx context.Context, userID, tokenID string, collection CollectionAPI) *echo.HTTPError {
+	docID, err := primitive.ObjectIDFromHex(tokenID)
+	if err != nil {
+		return echo.NewHTTPError(400, "Unable to convert to object id")
+	}
+
+	res, err := collection.UpdateOne(ctx, bson.M{"_id": docID, "user_id": userID}, bson.M{"$set": bson.M{"revoked": true}})
+	if err != nil {
+		return echo.NewHTTPError(500, "Unable to revoke token")
+	}
+
+	if res.MatchedCount == 0 {
+		return echo.NewHTTPError(404, "Token does not exist")
+	}
+
+	return nil
+}
+
+// Revoke every personal access token of the user
+func RevokeUserAccessTokens(ctx context.Context, userID string, collection CollectionAPI) *echo.HTTPError {
+	_, err := collection.UpdateMany(ctx, bson.M{"user_id": userID, "revoked": false}, bson.M{"$set": bson.M{"revoked": true}})
+	if err != nil {
+		return echo.NewHTTPError(500, "Unable to revoke tokens")
+	}
+
+	return nil
+}
+
+// Find the active personal access token and record its use
+func UseAccessToken(ctx context.Context, token string, collection CollectionAPI) (models.AccessToken, *echo.HTTPError) {
+	var accessToken models.AccessToken
+
+	now := time.Now()
+	filter := bson.M{
+		"token_hash": hashToken(token),
+		"revoked":    false,
+		"$or":        bson.A{bson.M{"expires_at": nil}, bson.M{"expires_at": bson.M{"$gt": now}}},
+	}
+
+	result := collection.FindOneAndUpdate(ctx, filter, bson.M{"$set": bson.M{"last_used_at": now}})
+	if err := result.Decode(&accessToken); err != nil {
+		return accessToken, echo.NewHTTPError(401, "Invalid, expired or revoked token")
+	}
+
+	return accessToken, nil
+}
+
+// generate a random url safe token to hand to the client. Only its hash should be stored
+func generateToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hash a token before store it or look it up in the db
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
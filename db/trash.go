@@ -0,0 +1,183 @@
+package db
+
+import (
+	"contacts/models"
+	"context"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Retrieve a page of the posts deleted by the user that can still be restored.
+// Posts removed by moderators are not restorable by their owner
+func GetTrash(ctx context.Context, userID string, query models.PageQuery, collection CollectionAPI) ([]models.Post, string, *echo.HTTPError) {
+	var posts []models.Post
+
+	cutoff := time.Now().Add(-cfg.TrashRetention)
+	filter := bson.M{"from": userID, "deleted_by": userID, "deleted_at": bson.M{"$gt": cutoff}}
+	next, httpErr := findPage(ctx, collection, filter, query, &posts)
+	return posts, next, httpErr
+}
+
+// Retrieve a page of the comments deleted by the user that can still be restored, last deleted first.
+// Comments removed by moderators are not restorable by their owner
+func GetTrashedComments(ctx context.Context, userID string, query models.PageQuery, collection CollectionAPI) ([]models.TrashedComment, string, *echo.HTTPError) {
+	offset, httpErr := pageOffset(query)
+	if httpErr != nil {
+		return nil, "", httpErr
+	}
+
+	cutoff := time.Now().Add(-cfg.TrashRetention)
+	match := bson.M{"from": userID, "deleted_by": userID, "deleted_at": bson.M{"$gt": cutoff}}
+	pipeline := []bson.M{
+		{"$match": bson.M{"deleted_at": nil, "deleted_comments": bson.M{"$elemMatch": match}}},
+		{"$unwind": "$deleted_comments"},
+		{"$match": bson.M{
+			"deleted_comments.from":       userID,
+			"deleted_comments.deleted_by": userID,
+			"deleted_comments.deleted_at": bson.M{"$gt": cutoff},
+		}},
+		{"$sort": bson.D{{Key: "deleted_comments.deleted_at", Value: -1}, {Key: "deleted_comments._id", Value: -1}}},
+		{"$skip": offset},
+		{"$limit": query.Limit + 1},
+		{"$project": bson.M{"deleted_comments": 1}},
+	}
+
+	var found []struct {
+		PostID  primitive.ObjectID `bson:"_id"`
+		Comment models.Comment     `bson:"deleted_comments"`
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, "", echo.NewHTTPError(404, "Unable to find posts")
+	}
+
+	if err = cursor.All(ctx, &found); err != nil {
+		return nil, "", echo.NewHTTPError(500, "Unable to parse retrieved posts")
+	}
+
+	more := len(found) > query.Limit
+	if more {
+		found = found[:query.Limit]
+	}
+
+	comments := make([]models.TrashedComment, len(found))
+	for i, comment := range found {
+		comments[i] = models.TrashedComment{PostID: comment.PostID.Hex(), Comment: comment.Comment}
+	}
+
+	return comments, nextOffsetCursor(offset, more, query), nil
+}
+
+// Bring back a post the user deleted
+func RestorePost(ctx context.Context, id, userID string, collection CollectionAPI) (models.Post, *echo.HTTPError) {
+	var post models.Post
+
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return post, echo.NewHTTPError(400, "Unable to convert to object id")
+	}
+
+	cutoff := time.Now().Add(-cfg.TrashRetention)
+	filter := bson.M{"_id": docID, "from": userID, "deleted_by": userID, "deleted_at": bson.M{"$gt": cutoff}}
+	update := bson.M{
+		"$set":   bson.M{"fanout_pending": true},
+		"$unset": bson.M{"deleted_at": "", "deleted_by": "", "fanout_lock": ""},
+	}
+
+	result := collection.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After))
+	err = result.Decode(&post)
+	if err == mongo.ErrNoDocuments {
+		return post, echo.NewHTTPError(404, "Post is not in your trash")
+	}
+
+	if err != nil {
+		return post, echo.NewHTTPError(500, "Unable to restore post")
+	}
+
+	return post, nil
+}
+
+// Bring back a comment the user deleted to its place in the post
+func RestoreComment(ctx context.Context, postID, commentID, userID string, collection CollectionAPI) (models.Post, *echo.HTTPError) {
+	post, httpErr := FindPost(ctx, postID, collection)
+	if httpErr != nil {
+		return post, httpErr
+	}
+
+	commentDocID, err := primitive.ObjectIDFromHex(commentID)
+	if err != nil {
+		return post, echo.NewHTTPError(400, "Unable to convert to object id")
+	}
+
+	cutoff := time.Now().Add(-cfg.TrashRetention)
+	for _, comment := range post.DeletedComments {
+		if comment.ID != commentDocID || !isRestorable(comment.From, comment.DeletedBy, comment.DeletedAt, userID, cutoff) {
+			continue
+		}
+
+		comment.DeletedAt, comment.DeletedBy = nil, ""
+		update := bson.M{
+			"$pull": bson.M{"deleted_comments": bson.M{"_id": commentDocID}},
+			"$push": bson.M{"comments": bson.M{"$each": bson.A{comment}, "$sort": bson.M{"_id": 1}}},
+		}
+
+		result, err := collection.UpdateOne(ctx, bson.M{"_id": post.ID, "deleted_comments._id": commentDocID}, update)
+		if err != nil {
+			return post, echo.NewHTTPError(500, "Unable to restore comment")
+		}
+
+		if result.ModifiedCount == 0 {
+			return post, echo.NewHTTPError(404, "Comment is not in your trash")
+		}
+
+		return FindPost(ctx, postID, collection)
+	}
+
+	return post, echo.NewHTTPError(404, "Comment is not in your trash")
+}
+
+// Remove for good one post whose retention in the trash is over together with its revisions.
+// Return false if there is none
+func PurgeDeletedPost(ctx context.Context, posts, revisions CollectionAPI) (bool, error) {
+	var post models.Post
+
+	cutoff := time.Now().Add(-cfg.TrashRetention)
+	err := posts.FindOne(ctx, bson.M{"deleted_at": bson.M{"$lte": cutoff}}).Decode(&post)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if _, err = revisions.DeleteMany(ctx, bson.M{"post_id": post.ID.Hex()}); err != nil {
+		return false, err
+	}
+
+	if _, err = posts.DeleteOne(ctx, bson.M{"_id": post.ID}); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Remove for good the comments whose retention in the trash is over
+func PurgeDeletedComments(ctx context.Context, collection CollectionAPI) error {
+	cutoff := time.Now().Add(-cfg.TrashRetention)
+	expired := bson.M{"deleted_at": bson.M{"$lte": cutoff}}
+
+	_, err := collection.UpdateMany(ctx, bson.M{"deleted_comments": bson.M{"$elemMatch": expired}}, bson.M{"$pull": bson.M{"deleted_comments": expired}})
+	return err
+}
+
+// check if the deleted item can be restored by the user: it deleted its own item within the retention
+func isRestorable(from, deletedBy string, deletedAt *time.Time, userID string, cutoff time.Time) bool {
+	return from == userID && deletedBy == userID && deletedAt != nil && deletedAt.After(cutoff)
+}
@@ -0,0 +1,152 @@
+package db
+
+import (
+	"contacts/models"
+	"contacts/totp"
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// amount of recovery codes handed to the user when two factor is enabled
+const recoveryCodesCount = 10
+
+// Store a new secret pending of confirmation for the user
+func SetPendingTOTP(ctx context.Context, id, secret string, collection CollectionAPI) *echo.HTTPError {
+	user, httpErr := FindUser(ctx, id, collection)
+	if httpErr != nil {
+		return httpErr
+	}
+
+	if user.TOTPEnabled {
+		return echo.NewHTTPError(400, "Two factor authentication already enabled")
+	}
+
+	if _, err := collection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"totp_pending": secret}}); err != nil {
+		return echo.NewHTTPError(500, "Unable to update user")
+	}
+
+	return nil
+}
+
+// Enable two factor authentication if the code matches the pending secret.
+// Return the recovery codes, only their hashes are stored
+func ConfirmTOTP(ctx context.Context, id, code string, collection CollectionAPI) ([]string, *echo.HTTPError) {
+	user, httpErr := FindUser(ctx, id, collection)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+
+	if user.TOTPPending == "" {
+		return nil, echo.NewHTTPError(400, "Two factor setup was not started")
+	}
+
+	step, ok := totp.Validate(user.TOTPPending, code, time.Now(), 1)
+	if !ok {
+		return nil, echo.NewHTTPError(400, "Invalid code")
+	}
+
+	codes := make([]string, recoveryCodesCount)
+	hashes := make([]string, recoveryCodesCount)
+	for i := range codes {
+		recoveryCode, err := generateRecoveryCode()
+		if err != nil {
+			return nil, echo.NewHTTPError(500, "Unable to create recovery codes")
+		}
+
+		hash, err := hashPassword(recoveryCode)
+		if err != nil {
+			return nil, echo.NewHTTPError(500, "Unable to hash recovery codes")
+		}
+
+		codes[i], hashes[i] = recoveryCode, hash
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"totp_enabled":   true,
+			"totp_secret":    user.TOTPPending,
+			"totp_last_step": step,
+			"recovery_codes": hashes,
+		},
+		"$unset": bson.M{"totp_pending": ""},
+	}
+
+	if _, err := collection.UpdateOne(ctx, bson.M{"_id": user.ID}, update); err != nil {
+		return nil, echo.NewHTTPError(500, "Unable to update user")
+	}
+
+	return codes, nil
+}
+
+// Check the second factor of the user, an authenticator code or a recovery code.
+// Codes are single use: used steps and recovery codes are rejected afterwards
+func VerifySecondFactor(ctx context.Context, id, code, recoveryCode string, collection CollectionAPI) (models.User, *echo.HTTPError) {
+	user, httpErr := FindUser(ctx, id, collection)
+	if httpErr != nil {
+		return user, httpErr
+	}
+
+	if !user.TOTPEnabled {
+		return user, echo.NewHTTPError(400, "Two factor authentication is not enabled")
+	}
+
+	if code != "" {
+		step, ok := totp.Validate(user.TOTPSecret, code, time.Now(), 1)
+		if !ok || step <= user.TOTPLastStep {
+			return user, echo.NewHTTPError(400, "Invalid code")
+		}
+
+		filter := bson.M{"_id": user.ID, "totp_last_step": bson.M{"$lt": step}}
+		res, err := collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"totp_last_step": step}})
+		if err != nil {
+			return user, echo.NewHTTPError(500, "Unable to update user")
+		}
+
+		if res.ModifiedCount == 0 {
+			return user, echo.NewHTTPError(400, "Invalid code")
+		}
+
+		return user, nil
+	}
+
+	for _, hash := range user.RecoveryCodes {
+		if !isValidCredential(normalizeRecoveryCode(recoveryCode), hash) {
+			continue
+		}
+
+		res, err := collection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$pull": bson.M{"recovery_codes": hash}})
+		if err != nil {
+			return user, echo.NewHTTPError(500, "Unable to update user")
+		}
+
+		if res.ModifiedCount == 0 {
+			break
+		}
+
+		return user, nil
+	}
+
+	return user, echo.NewHTTPError(400, "Invalid recovery code")
+}
+
+// generate a random recovery code like abcde-fghij
+func generateRecoveryCode() (string, error) {
+	buf := make([]byte, 7)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	code := strings.ToLower(base32.StdEncoding.EncodeToString(buf))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+// recovery codes are accepted regardless of case and surrounding spaces
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.TrimSpace(code))
+}
@@ -8,6 +8,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -25,13 +26,20 @@ func CreateUser(ctx context.Context, user models.User, collection CollectionAPI)
 		return nil, echo.NewHTTPError(400, "That user already exist")
 	}
 
-	hashpwd, err := bcrypt.GenerateFromPassword([]byte(user.Password), 8)
+	hashpwd, err := hashPassword(user.Password)
 	if err != nil {
 		return nil, echo.NewHTTPError(500, "Unable to hash password")
 	}
 
-	user.ID = primitive.NewObjectID()
-	user.Password = string(hashpwd)
+	// only the credentials come from the signup, every other field is owned by the server
+	user = models.User{
+		ID:            primitive.NewObjectID(),
+		Username:      user.Username,
+		Email:         user.Email,
+		Password:      hashpwd,
+		Roles:         []string{models.RoleUser},
+		TimelineReady: true,
+	}
 
 	res, err := collection.InsertOne(ctx, user)
 	if err != nil {
@@ -62,6 +70,16 @@ func LoginUser(ctx context.Context, reqUser models.User, collection CollectionAP
 	return user, nil
 }
 
+// hash the given password to store it
+func hashPassword(password string) (string, error) {
+	hashpwd, err := bcrypt.GenerateFromPassword([]byte(password), 8)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hashpwd), nil
+}
+
 // check if the given password is correct
 func isValidCredential(givenPWD, storePWD string) bool {
 	if err := bcrypt.CompareHashAndPassword([]byte(storePWD), []byte(givenPWD)); err != nil {
@@ -71,104 +89,287 @@ func isValidCredential(givenPWD, storePWD string) bool {
 	return true
 }
 
-// get user by id
-func RetrieveUser(ctx context.Context, id string, collection CollectionAPI) (models.User, *echo.HTTPError) {
+// get the whole user document by id
+func FindUser(ctx context.Context, id string, collection CollectionAPI) (models.User, *echo.HTTPError) {
 	var user models.User
 
 	docID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return user, echo.NewHTTPError(500, "Unable to convert to object id")
+		return user, echo.NewHTTPError(400, "Unable to convert to object id")
 	}
 
 	result := collection.FindOne(ctx, bson.M{"_id": docID})
+	err = result.Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return user, echo.NewHTTPError(404, "User does not exist")
+	}
+
+	if err != nil {
+		return user, echo.NewHTTPError(500, "Unable to decode retrieved user")
+	}
+
+	return user, nil
+}
+
+// get the public profile of the user by id with its counters
+func RetrieveUser(ctx context.Context, id string, users, posts CollectionAPI) (models.PublicProfile, *echo.HTTPError) {
+	var profile models.PublicProfile
+
+	user, httpErr := FindUser(ctx, id, users)
+	if httpErr != nil {
+		return profile, httpErr
+	}
+
+	filter := publishedFilter()
+	filter["from"] = id
+	postsCount, err := posts.CountDocuments(ctx, filter)
+	if err != nil {
+		return profile, echo.NewHTTPError(500, "Unable to count user posts")
+	}
+
+	profile = user.PublicProfile()
+	profile.PostsCount = postsCount
+
+	return profile, nil
+}
+
+// Update the profile fields of the user
+func UpdateProfile(ctx context.Context, id string, update models.ProfileUpdate, collection CollectionAPI) (models.User, *echo.HTTPError) {
+	var user models.User
+
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return user, echo.NewHTTPError(400, "Unable to convert to object id")
+	}
+
+	if update == (models.ProfileUpdate{}) {
+		return user, echo.NewHTTPError(400, "Nothing to update")
+	}
+
+	// empty strings remove the field
+	set, unset := bson.M{}, bson.M{}
+	for field, value := range map[string]*string{
+		"display_name": update.DisplayName,
+		"bio":          update.Bio,
+		"avatar_url":   update.AvatarURL,
+		"website":      update.Website,
+		"location":     update.Location,
+	} {
+		if value == nil {
+			continue
+		}
+
+		if *value == "" {
+			unset[field] = ""
+		} else {
+			set[field] = *value
+		}
+	}
+
+	if update.Private != nil {
+		set["private"] = *update.Private
+	}
+
+	changes := bson.M{}
+	if len(set) > 0 {
+		changes["$set"] = set
+	}
+	if len(unset) > 0 {
+		changes["$unset"] = unset
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	result := collection.FindOneAndUpdate(ctx, bson.M{"_id": docID}, changes, opts)
 	if err = result.Decode(&user); err != nil {
-		return user, echo.NewHTTPError(422, "Unable to parse retrieved user")
+		return user, echo.NewHTTPError(500, "Unable to update user")
+	}
+
+	return user, nil
+}
+
+// Change the password of the user checking the current one first
+func ChangePassword(ctx context.Context, id string, req models.PasswordChange, collection CollectionAPI) *echo.HTTPError {
+	user, httpErr := FindUser(ctx, id, collection)
+	if httpErr != nil {
+		return httpErr
+	}
+
+	if !isValidCredential(req.CurrentPassword, user.Password) {
+		return echo.NewHTTPError(400, "Invalid credentials")
+	}
+
+	hashpwd, err := hashPassword(req.NewPassword)
+	if err != nil {
+		return echo.NewHTTPError(500, "Unable to hash password")
+	}
+
+	if _, err = collection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"password": hashpwd}}); err != nil {
+		return echo.NewHTTPError(500, "Unable to update password")
 	}
 
-	return models.User{Username: user.Username}, nil
+	return nil
+}
+
+// Store the new email as pending until the user verifies it, the current email keeps working meanwhile
+func RequestEmailChange(ctx context.Context, id string, req models.EmailChange, collection CollectionAPI) (models.User, *echo.HTTPError) {
+	user, httpErr := FindUser(ctx, id, collection)
+	if httpErr != nil {
+		return user, httpErr
+	}
+
+	if !isValidCredential(req.Password, user.Password) {
+		return user, echo.NewHTTPError(400, "Invalid credentials")
+	}
+
+	if user.Email == req.Email {
+		return user, echo.NewHTTPError(400, "That is already your email")
+	}
+
+	err := collection.FindOne(ctx, bson.M{"email": req.Email}).Err()
+	if err != mongo.ErrNoDocuments {
+		return user, echo.NewHTTPError(400, "That email is already in use")
+	}
+
+	if _, err = collection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"pending_email": req.Email}}); err != nil {
+		return user, echo.NewHTTPError(500, "Unable to update user")
+	}
+
+	user.PendingEmail = req.Email
+	return user, nil
 }
 
+// results of the follow toggle
+const (
+	FollowFollowed         = "followed"
+	FollowUnfollowed       = "unfollowed"
+	FollowRequested        = "requested"
+	FollowRequestCancelled = "request cancelled"
+)
+
 // Manage the following system in the db fromID(requesting user) toID(users that requesting user want to follow)
-// also check if the requesting user already follows userTo and perform follow or unfollow
-func SetFollowUser(ctx context.Context, fromID string, toID string, collection CollectionAPI) *echo.HTTPError {
+// also check if the requesting user already follows userTo and perform follow or unfollow.
+// Following a private user creates a follow request, performing it again cancels the request
+func SetFollowUser(ctx context.Context, fromID string, toID string, collection CollectionAPI) (string, *echo.HTTPError) {
 	var userFrom models.User
 	var userTo models.User
 
 	fromDocID, err := primitive.ObjectIDFromHex(fromID)
 	if err != nil {
-		return echo.NewHTTPError(500, "Unable to convert to object id")
+		return "", echo.NewHTTPError(500, "Unable to convert to object id")
 	}
 
 	toDocID, err := primitive.ObjectIDFromHex(toID)
 	if err != nil {
-		return echo.NewHTTPError(500, "Unable to convert to object id")
+		return "", echo.NewHTTPError(500, "Unable to convert to object id")
 	}
 
 	result := collection.FindOne(ctx, bson.M{"_id": fromDocID})
 	if err = result.Decode(&userFrom); err != nil {
-		return echo.NewHTTPError(500, "Unable to decode retrieved user")
+		return "", echo.NewHTTPError(500, "Unable to decode retrieved user")
 	}
 
 	result = collection.FindOne(ctx, bson.M{"_id": toDocID})
 	if err = result.Decode(&userTo); err != nil {
-		return echo.NewHTTPError(500, "Unable to decode retrieved user")
+		return "", echo.NewHTTPError(500, "Unable to decode retrieved user")
 	}
 
-	if !contains(userTo.Followers, fromID) {
-		userFrom.Following = append(userFrom.Following, toID)
-		userTo.Followers = append(userTo.Followers, fromID)
+	if contains(userTo.Blocked, fromID) || contains(userFrom.Blocked, toID) {
+		return "", echo.NewHTTPError(403, "You can not follow this user")
+	}
 
-		_, err := collection.UpdateOne(ctx, bson.M{"_id": fromDocID}, bson.M{"$set": userFrom})
-		if err != nil {
-			return echo.NewHTTPError(500, "Unable to update user info")
+	if contains(userTo.Followers, fromID) {
+		if httpErr := removeFollow(ctx, fromDocID, toDocID, collection); httpErr != nil {
+			return "", httpErr
 		}
 
-		_, err = collection.UpdateOne(ctx, bson.M{"_id": toDocID}, bson.M{"$set": userTo})
-		if err != nil {
-			return echo.NewHTTPError(500, "Unable to update user data")
-		}
-	} else {
-		_, err = collection.UpdateOne(ctx, bson.M{"_id": toDocID}, bson.M{"$pull": bson.M{"followers": fromDocID}})
+		return FollowUnfollowed, nil
+	}
+
+	if contains(userTo.FollowRequests, fromID) {
+		_, err = collection.UpdateOne(ctx, bson.M{"_id": toDocID}, bson.M{"$pull": bson.M{"follow_requests": fromID}})
 		if err != nil {
-			return echo.NewHTTPError(500, "Unable to update user")
+			return "", echo.NewHTTPError(500, "Unable to update user")
 		}
 
-		_, err = collection.UpdateOne(ctx, bson.M{"_id": fromDocID}, bson.M{"$pull:": bson.M{"following": toDocID}})
+		return FollowRequestCancelled, nil
+	}
+
+	if userTo.Private {
+		_, err = collection.UpdateOne(ctx, bson.M{"_id": toDocID}, bson.M{"$addToSet": bson.M{"follow_requests": fromID}})
 		if err != nil {
-			return echo.NewHTTPError(500, "Unable to update user")
+			return "", echo.NewHTTPError(500, "Unable to update user")
 		}
+
+		return FollowRequested, nil
 	}
 
-	return nil
+	if httpErr := addFollow(ctx, fromDocID, toDocID, collection); httpErr != nil {
+		return "", httpErr
+	}
+
+	return FollowFollowed, nil
 }
 
-// Retrieve all followers of the user
-func GetUserFollowers(ctx context.Context, id primitive.ObjectID, collection CollectionAPI) ([]models.User, *echo.HTTPError) {
-	var followers []primitive.ObjectID
-	var users []models.User
-	var user models.User
+// add fromID to the followers of toID and toID to the following of fromID,
+// the recent posts of toID are then backfilled into the timeline of fromID
+func addFollow(ctx context.Context, fromID, toID primitive.ObjectID, collection CollectionAPI) *echo.HTTPError {
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": fromID}, bson.M{"$addToSet": bson.M{"following": toID.Hex(), "timeline_backfill": toID.Hex()}})
+	if err != nil {
+		return echo.NewHTTPError(500, "Unable to update user info")
+	}
 
-	result := collection.FindOne(ctx, bson.M{"_id": id})
-	if err := result.Decode(&user); err != nil {
-		return nil, echo.NewHTTPError(500, "Unable to decode retrieved user")
+	// the count only changes with the followers, an existing follow is not counted twice
+	update := bson.M{"$addToSet": bson.M{"followers": fromID.Hex()}, "$inc": bson.M{"followers_count": 1}}
+	_, err = collection.UpdateOne(ctx, bson.M{"_id": toID, "followers": bson.M{"$ne": fromID.Hex()}}, update)
+	if err != nil {
+		return echo.NewHTTPError(500, "Unable to update user data")
 	}
 
-	for _, userId := range user.Followers {
-		docID, err := primitive.ObjectIDFromHex(userId)
-		if err != nil {
-			return nil, echo.NewHTTPError(500, "Unable to convert to object id")
-		}
-		followers = append(followers, docID)
+	return nil
+}
+
+// remove fromID from the followers of toID and toID from the following of fromID
+func removeFollow(ctx context.Context, fromID, toID primitive.ObjectID, collection CollectionAPI) *echo.HTTPError {
+	update := bson.M{"$pull": bson.M{"followers": fromID.Hex()}, "$inc": bson.M{"followers_count": -1}}
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": toID, "followers": fromID.Hex()}, update)
+	if err != nil {
+		return echo.NewHTTPError(500, "Unable to update user")
 	}
 
-	cursor, err := collection.Find(ctx, bson.M{"_id": bson.M{"$in": followers}})
+	_, err = collection.UpdateOne(ctx, bson.M{"_id": fromID}, bson.M{"$pull": bson.M{"following": toID.Hex(), "timeline_backfill": toID.Hex()}})
 	if err != nil {
-		return nil, echo.NewHTTPError(404, "Unable to find users")
+		return echo.NewHTTPError(500, "Unable to update user")
 	}
 
-	if err = cursor.All(ctx, &users); err != nil {
-		return nil, echo.NewHTTPError(500, "Unable to parse retrieved users")
+	return nil
+}
+
+// Count the followers of the users stored before the count was kept with them
+func SyncFollowerCounts(ctx context.Context, collection CollectionAPI) error {
+	count := bson.A{bson.M{"$set": bson.M{"followers_count": bson.M{"$size": bson.M{"$ifNull": bson.A{"$followers", bson.A{}}}}}}}
+	_, err := collection.UpdateMany(ctx, bson.M{"followers_count": bson.M{"$exists": false}}, count)
+	return err
+}
+
+// Replace the roles of the user
+func SetUserRoles(ctx context.Context, id string, roles []string, collection CollectionAPI) (models.User, *echo.HTTPError) {
+	var user models.User
+
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return user, echo.NewHTTPError(400, "Unable to convert to object id")
 	}
 
-	return users, nil
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	result := collection.FindOneAndUpdate(ctx, bson.M{"_id": docID}, bson.M{"$set": bson.M{"roles": roles}}, opts)
+	err = result.Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return user, echo.NewHTTPError(404, "User does not exist")
+	}
+
+	if err != nil {
+		return user, echo.NewHTTPError(500, "Unable to update user roles")
+	}
+
+	return user, nil
 }
@@ -0,0 +1,100 @@
+package db
+
+import (
+	"contacts/models"
+	"context"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// indexes of the email verifications collection. Expired verifications are removed by mongo
+var VerificationIndexes = []mongo.IndexModel{
+	{Keys: bson.M{"token_hash": 1}},
+	{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	{Keys: bson.M{"expires_at": 1}, Options: options.Index().SetExpireAfterSeconds(0)},
+}
+
+// Create a verification token for the email of the user.
+// A new token can only be requested once the resend wait of the previous one is over
+func CreateVerification(ctx context.Context, userID, email string, collection CollectionAPI) (string, *echo.HTTPError) {
+	var last models.EmailVerification
+
+	opts := options.FindOne().SetSort(bson.M{"created_at": -1})
+	err := collection.FindOne(ctx, bson.M{"user_id": userID}, opts).Decode(&last)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return "", echo.NewHTTPError(500, "Unable to decode retrieved verification")
+	}
+
+	if err == nil && time.Since(last.CreatedAt) < cfg.VerificationResendWait {
+		return "", echo.NewHTTPError(429, "Wait before requesting another verification mail")
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return "", echo.NewHTTPError(500, "Unable to create verification token")
+	}
+
+	now := time.Now()
+	verification := models.EmailVerification{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Email:     email,
+		TokenHash: hashToken(token),
+		CreatedAt: now,
+		ExpiresAt: now.Add(cfg.VerificationTTL),
+	}
+
+	if _, err = collection.InsertOne(ctx, verification); err != nil {
+		return "", echo.NewHTTPError(500, "Unable to create verification token")
+	}
+
+	return token, nil
+}
+
+// Consume the verification token and mark the user as verified. The token is only
+// valid while the user keeps the email it was sent to, or still wants to change to it
+func VerifyEmail(ctx context.Context, token string, users, verifications CollectionAPI) *echo.HTTPError {
+	var verification models.EmailVerification
+
+	filter := bson.M{"token_hash": hashToken(token), "used": false, "expires_at": bson.M{"$gt": time.Now()}}
+	result := verifications.FindOneAndUpdate(ctx, filter, bson.M{"$set": bson.M{"used": true}})
+	if err := result.Decode(&verification); err != nil {
+		return echo.NewHTTPError(400, "Invalid or expired verification token")
+	}
+
+	docID, err := primitive.ObjectIDFromHex(verification.UserID)
+	if err != nil {
+		return echo.NewHTTPError(500, "Unable to convert to object id")
+	}
+
+	res, err := users.UpdateOne(ctx, bson.M{"_id": docID, "email": verification.Email}, bson.M{"$set": bson.M{"verified": true}})
+	if err != nil {
+		return echo.NewHTTPError(500, "Unable to verify user")
+	}
+
+	if res.MatchedCount > 0 {
+		return nil
+	}
+
+	// the token was sent to a new email the user asked to change to
+	update := bson.M{
+		"$set":   bson.M{"email": verification.Email, "verified": true},
+		"$unset": bson.M{"pending_email": ""},
+	}
+
+	res, err = users.UpdateOne(ctx, bson.M{"_id": docID, "pending_email": verification.Email}, update)
+	if err != nil {
+		return echo.NewHTTPError(400, "That email is already in use")
+	}
+
+	if res.MatchedCount == 0 {
+		return echo.NewHTTPError(400, "Invalid or expired verification token")
+	}
+
+	return nil
+}
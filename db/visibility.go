@@ -0,0 +1,102 @@
+package db
+
+import (
+	"contacts/models"
+	"context"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Check if the viewer can see the posts of the author. Users that blocked the viewer
+// and private users the viewer does not follow hide their posts
+func CanViewAuthor(ctx context.Context, viewerID, authorID string, collection CollectionAPI) (bool, *echo.HTTPError) {
+	if viewerID == authorID {
+		return true, nil
+	}
+
+	author, httpErr := FindUser(ctx, authorID, collection)
+	if httpErr != nil {
+		return false, httpErr
+	}
+
+	if contains(author.Blocked, viewerID) {
+		return false, nil
+	}
+
+	if author.Private && !contains(author.Followers, viewerID) {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// Get the authors whose posts are left out of the listings of the viewer: users that blocked it
+// and users it muted. Private users it does not follow are left out by visibleFilter
+func HiddenAuthors(ctx context.Context, viewer models.User, collection CollectionAPI) ([]string, *echo.HTTPError) {
+	blockedBy, httpErr := blockedByIDs(ctx, viewer.ID.Hex(), collection)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+
+	return append(blockedBy, viewer.Muted...), nil
+}
+
+// filter of the posts the viewer can see by their author: not hidden, and public or followed
+func visibleFilter(viewer models.User, hidden []string) bson.M {
+	return bson.M{
+		"from": bson.M{"$nin": append([]string{}, hidden...)},
+		"$or": bson.A{
+			bson.M{"author_private": bson.M{"$ne": true}},
+			bson.M{"from": bson.M{"$in": append([]string{viewer.ID.Hex()}, viewer.Following...)}},
+		},
+	}
+}
+
+// filter of the posts anyone can see, even without an account: published posts of public users
+func publicFilter() bson.M {
+	filter := publishedFilter()
+	filter["author_private"] = bson.M{"$ne": true}
+	return filter
+}
+
+// Copy the privacy of the user to its posts and activity, they are filtered by it
+func SetAuthorPrivacy(ctx context.Context, userID string, private bool, posts, activity CollectionAPI) *echo.HTTPError {
+	update := bson.M{"$unset": bson.M{"author_private": ""}}
+	if private {
+		update = bson.M{"$set": bson.M{"author_private": true}}
+	}
+
+	if _, err := posts.UpdateMany(ctx, bson.M{"from": userID}, update); err != nil {
+		return echo.NewHTTPError(500, "Unable to update posts")
+	}
+
+	if _, err := activity.UpdateMany(ctx, bson.M{"author_id": userID}, update); err != nil {
+		return echo.NewHTTPError(500, "Unable to update activity")
+	}
+
+	return nil
+}
+
+// Mark the posts and activity of every private user, for the ones stored before they kept
+// the privacy of their author
+func SyncAuthorPrivacy(ctx context.Context, users, posts, activity CollectionAPI) error {
+	var private []models.User
+	cursor, err := users.Find(ctx, bson.M{"private": true}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return err
+	}
+
+	if err = cursor.All(ctx, &private); err != nil {
+		return err
+	}
+
+	for _, user := range private {
+		if httpErr := SetAuthorPrivacy(ctx, user.ID.Hex(), true, posts, activity); httpErr != nil {
+			return httpErr
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package diff
+
+import "strings"
+
+// kinds of the lines of a diff
+const (
+	Equal  = ' '
+	Delete = '-'
+	Insert = '+'
+)
+
+// Line of a diff with the kind of change
+type Line struct {
+	Op   byte
+	Text string
+}
+
+// Compute the shortest line diff to turn a into b using the Myers algorithm. Texts needing more
+// than MaxEdits edits are diffed as every line of a deleted and every line of b inserted
+func Lines(a, b string) []Line {
+	return compute(split(a), split(b))
+}
+
+// Render the line diff to turn a into b as text, every line prefixed by its kind of change.
+// Return an empty string when both are equal
+func Text(a, b string) string {
+	if a == b {
+		return ""
+	}
+
+	var sb strings.Builder
+	for _, line := range Lines(a, b) {
+		sb.WriteByte(line.Op)
+		sb.WriteByte(' ')
+		sb.WriteString(line.Text)
+		sb.WriteByte('\n')
+	}
+
+	return sb.String()
+}
+
+// split the text in lines, an empty text has no lines
+func split(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// texts whose shortest diff needs more edits than this are diffed as replaced, tracing the paths
+// takes memory quadratic in the edits
+const MaxEdits = 1000
+
+// the common first and last lines are kept out of the search, then the furthest reaching paths are
+// found for every amount of edits until both ends meet and walked back to build the edit script
+func compute(a, b []string) []Line {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var lines []Line
+	for _, text := range a[:prefix] {
+		lines = append(lines, Line{Op: Equal, Text: text})
+	}
+
+	lines = append(lines, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, text := range a[len(a)-suffix:] {
+		lines = append(lines, Line{Op: Equal, Text: text})
+	}
+
+	return lines
+}
+
+// the Myers search. Only the part of the paths that the next edit reads is traced
+func myers(a, b []string) []Line {
+	n, m := len(a), len(b)
+	if n+m == 0 {
+		return nil
+	}
+
+	max := n + m
+	if max > MaxEdits {
+		max = MaxEdits
+	}
+
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				return backtrack(a, b, trace)
+			}
+		}
+	}
+
+	return replaced(a, b)
+}
+
+// diff of texts too different to search: every line of a deleted and every line of b inserted
+func replaced(a, b []string) []Line {
+	lines := make([]Line, 0, len(a)+len(b))
+	for _, text := range a {
+		lines = append(lines, Line{Op: Delete, Text: text})
+	}
+	for _, text := range b {
+		lines = append(lines, Line{Op: Insert, Text: text})
+	}
+
+	return lines
+}
+
+// walk the traced paths from the end to the start building the lines in order. The paths
+// traced before edit d hold the diagonals -d-1 to d+1
+func backtrack(a, b []string, trace [][]int) []Line {
+	var lines []Line
+	x, y := len(a), len(b)
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		offset := d + 1
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			lines = append(lines, Line{Op: Equal, Text: a[x-1]})
+			x--
+			y--
+		}
+
+		if d > 0 {
+			if x == prevX {
+				lines = append(lines, Line{Op: Insert, Text: b[y-1]})
+			} else {
+				lines = append(lines, Line{Op: Delete, Text: a[x-1]})
+			}
+		}
+
+		x, y = prevX, prevY
+	}
+
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+
+	return lines
+}
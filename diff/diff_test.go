@@ -0,0 +1,153 @@
+package diff
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// apply the lines of a diff to rebuild both texts
+func apply(lines []Line) (string, string) {
+	var a, b []string
+	for _, line := range lines {
+		if line.Op != Insert {
+			a = append(a, line.Text)
+		}
+		if line.Op != Delete {
+			b = append(b, line.Text)
+		}
+	}
+
+	join := func(lines []string) string {
+		if len(lines) == 0 {
+			return ""
+		}
+		return strings.Join(lines, "\n") + "\n"
+	}
+
+	return join(a), join(b)
+}
+
+func edits(lines []Line) int {
+	count := 0
+	for _, line := range lines {
+		if line.Op != Equal {
+			count++
+		}
+	}
+
+	return count
+}
+
+func numbered(prefix string, from, to int) string {
+	var sb strings.Builder
+	for i := from; i < to; i++ {
+		sb.WriteString(prefix + strconv.Itoa(i) + "\n")
+	}
+
+	return sb.String()
+}
+
+func TestText(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"equal", "a\nb\n", "a\nb\n", ""},
+		{"both empty", "", "", ""},
+		{"from empty", "", "a\nb", "+ a\n+ b\n"},
+		{"to empty", "a\nb", "", "- a\n- b\n"},
+		{"insert", "a\nc", "a\nb\nc", "  a\n+ b\n  c\n"},
+		{"delete", "a\nb\nc", "a\nc", "  a\n- b\n  c\n"},
+		{"replace", "a\nb\nc", "a\nx\nc", "  a\n- b\n+ x\n  c\n"},
+	}
+
+	for _, c := range cases {
+		if got := Text(c.a, c.b); got != c.want {
+			t.Errorf("%s: got %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestLinesShortest(t *testing.T) {
+	cases := []struct {
+		a, b  string
+		edits int
+	}{
+		{"a\nb\nc\na\nb\nb\na", "c\nb\na\nb\na\nc", 5},
+		{"a\nb\nc\nd", "d\nc\nb\na", 6},
+		{"x\na\nb\nc", "a\nb\nc\ny", 2},
+		{"a\nb\nc", "a\nb\nc\na\nb\nc", 3},
+	}
+
+	for _, c := range cases {
+		lines := Lines(c.a, c.b)
+		a, b := apply(lines)
+		if a != c.a+"\n" || b != c.b+"\n" {
+			t.Errorf("%q -> %q: diff rebuilds %q -> %q", c.a, c.b, a, b)
+		}
+
+		if got := edits(lines); got != c.edits {
+			t.Errorf("%q -> %q: got %d edits, want %d", c.a, c.b, got, c.edits)
+		}
+	}
+}
+
+func TestLinesKeepsCommonEnds(t *testing.T) {
+	a := numbered("same ", 0, 3000) + "old\n" + numbered("end ", 0, 3000)
+	b := numbered("same ", 0, 3000) + "new\n" + numbered("end ", 0, 3000)
+
+	lines := Lines(a, b)
+	if got := edits(lines); got != 2 {
+		t.Fatalf("got %d edits, want 2", got)
+	}
+
+	if gotA, gotB := apply(lines); gotA != a || gotB != b {
+		t.Fatal("diff does not rebuild the texts")
+	}
+}
+
+func TestLinesReplacedAboveMaxEdits(t *testing.T) {
+	a := numbered("a ", 0, 8000)
+	b := numbered("b ", 0, 8000)
+
+	start := time.Now()
+	lines := Lines(a, b)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("diff took %s", elapsed)
+	}
+
+	if len(lines) != 16000 {
+		t.Fatalf("got %d lines, want 16000", len(lines))
+	}
+
+	for i, line := range lines {
+		want := byte(Delete)
+		if i >= 8000 {
+			want = Insert
+		}
+		if line.Op != want {
+			t.Fatalf("line %d: got op %q, want %q", i, line.Op, want)
+		}
+	}
+
+	if gotA, gotB := apply(lines); gotA != a || gotB != b {
+		t.Fatal("diff does not rebuild the texts")
+	}
+}
+
+func TestLinesAtMaxEdits(t *testing.T) {
+	a := numbered("a ", 0, MaxEdits/2)
+	b := numbered("b ", 0, MaxEdits/2)
+
+	lines := Lines(a, b)
+	if got := edits(lines); got != MaxEdits {
+		t.Fatalf("got %d edits, want %d", got, MaxEdits)
+	}
+
+	if gotA, gotB := apply(lines); gotA != a || gotB != b {
+		t.Fatal("diff does not rebuild the texts")
+	}
+}
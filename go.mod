@@ -3,13 +3,15 @@ module contacts
 go 1.16
 
 require (
-	github.com/dgrijalva/jwt-go v3.2.0+incompatible // indirect
+	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/go-playground/universal-translator v0.17.0 // indirect
-	github.com/ilyakaznacheev/cleanenv v1.2.5 // indirect
+	github.com/ilyakaznacheev/cleanenv v1.2.5
 	github.com/labstack/echo/v4 v4.2.1 // direct
 	github.com/labstack/gommon v0.3.0 // indirect
 	github.com/leodido/go-urn v1.2.1 // indirect
-	go.mongodb.org/mongo-driver v1.5.0 // indirect
-	golang.org/x/crypto v0.0.0-20210322153248-0c34fe9e7dc2 // indirect
-	gopkg.in/go-playground/validator.v9 v9.31.0 // indirect
+	github.com/microcosm-cc/bluemonday v1.0.27
+	github.com/yuin/goldmark v1.4.13
+	go.mongodb.org/mongo-driver v1.5.0
+	golang.org/x/crypto v0.24.0
+	gopkg.in/go-playground/validator.v9 v9.31.0
 )
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"contacts/db"
+	"contacts/models"
+	"context"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Admin handler definition
+type AdminHandler struct {
+	Users     db.CollectionAPI
+	Throttles db.CollectionAPI
+	Attempts  db.CollectionAPI
+}
+
+// Retrieve the roles of the user
+func (a *AdminHandler) GetUserRoles(c echo.Context) error {
+	user, httpErr := db.FindUser(context.Background(), c.Param("id"), a.Users)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, models.UserRoles{Roles: user.GetRoles()})
+}
+
+// Replace the roles of the user. Changes apply once the user refreshes the access token
+func (a *AdminHandler) SetUserRoles(c echo.Context) error {
+	var req models.UserRoles
+	c.Echo().Validator = &UsersValidator{validator: v}
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(422, "Unable to parse request body")
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return c.JSON(400, "Invalid request body")
+	}
+
+	user, httpErr := db.SetUserRoles(context.Background(), c.Param("id"), req.Roles, a.Users)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, models.UserRoles{Roles: user.GetRoles()})
+}
+
+// Unlock the logins of the user blocked by failed attempts
+func (a *AdminHandler) UnlockUser(c echo.Context) error {
+	ctx := context.Background()
+	user, httpErr := db.FindUser(ctx, c.Param("id"), a.Users)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	keys := []string{
+		models.ThrottleKey(models.ThrottleUser, user.Username),
+		models.ThrottleKey(models.ThrottleTwoFactor, user.ID.Hex()),
+	}
+	for _, key := range keys {
+		if httpErr = db.ResetLoginThrottle(ctx, key, a.Throttles); httpErr != nil {
+			return c.JSON(httpErr.Code, httpErr.Message)
+		}
+	}
+
+	return c.JSON(200, "User unlocked successfuly")
+}
+
+// Unlock the logins from the ip blocked by failed attempts
+func (a *AdminHandler) UnlockIP(c echo.Context) error {
+	key := models.ThrottleKey(models.ThrottleIP, c.Param("ip"))
+	if httpErr := db.ResetLoginThrottle(context.Background(), key, a.Throttles); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, "IP unlocked successfuly")
+}
+
+// List the latest login attempts filtered by the username and ip query params
+func (a *AdminHandler) ListLoginAttempts(c echo.Context) error {
+	attempts, next, httpErr := db.ListLoginAttempts(context.Background(), c.QueryParam("username"), c.QueryParam("ip"), pageFromQuery(c), a.Attempts)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, models.Page{Data: attempts, NextCursor: next})
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"contacts/db"
+	"contacts/models"
+	"context"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Handle blocking and unblocking users
+func (u *UsersHandler) BlockUser(c echo.Context) error {
+	ctx := context.Background()
+	fromID, toID := userIDFromToken(c), c.Param("id")
+
+	blocked, httpErr := db.ToggleBlock(ctx, fromID, toID, u.Col)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if !blocked {
+		return c.JSON(200, "User unblocked successfuly")
+	}
+
+	// the follows both ways are removed by the block
+	if httpErr = db.RemoveTimelineAuthor(ctx, fromID, toID, u.Timelines); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if httpErr = db.RemoveTimelineAuthor(ctx, toID, fromID, u.Timelines); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, "User blocked successfuly")
+}
+
+// Handle muting and unmuting users
+func (u *UsersHandler) MuteUser(c echo.Context) error {
+	muted, httpErr := db.ToggleMute(context.Background(), userIDFromToken(c), c.Param("id"), u.Col)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if !muted {
+		return c.JSON(200, "User unmuted successfuly")
+	}
+
+	return c.JSON(200, "User muted successfuly")
+}
+
+// List the users blocked by the requesting user
+func (u *UsersHandler) GetBlocked(c echo.Context) error {
+	users, next, httpErr := db.GetBlockedUsers(context.Background(), userIDFromToken(c), pageFromQuery(c), u.Col)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, models.Page{Data: users, NextCursor: next})
+}
+
+// List the users muted by the requesting user
+func (u *UsersHandler) GetMuted(c echo.Context) error {
+	users, next, httpErr := db.GetMutedUsers(context.Background(), userIDFromToken(c), pageFromQuery(c), u.Col)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, models.Page{Data: users, NextCursor: next})
+}
+
+// List the pending follow requests of the requesting user
+func (u *UsersHandler) GetFollowRequests(c echo.Context) error {
+	users, next, httpErr := db.GetFollowRequests(context.Background(), userIDFromToken(c), pageFromQuery(c), u.Col)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, models.Page{Data: users, NextCursor: next})
+}
+
+// Approve a follow request of the requesting user
+func (u *UsersHandler) ApproveFollowRequest(c echo.Context) error {
+	httpErr := db.ApproveFollowRequest(context.Background(), userIDFromToken(c), c.Param("id"), u.Col)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, "Follow request approved")
+}
+
+// Reject a follow request of the requesting user
+func (u *UsersHandler) RejectFollowRequest(c echo.Context) error {
+	httpErr := db.RejectFollowRequest(context.Background(), userIDFromToken(c), c.Param("id"), u.Col)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, "Follow request rejected")
+}
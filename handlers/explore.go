@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"contacts/db"
+	"contacts/models"
+	"context"
+
+	"github.com/labstack/echo/v4"
+)
+
+// List the recent posts of public users, no account is needed
+func (p *PostsHandler) Explore(c echo.Context) error {
+	posts, next, httpErr := db.GetExplore(context.Background(), pageFromQuery(c), p.Col)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, models.Page{Data: posts, NextCursor: next})
+}
+
+// List the posts with more likes and comments within the requested window, no account is needed
+func (p *PostsHandler) TrendingPosts(c echo.Context) error {
+	posts, next, httpErr := db.GetTrendingPosts(context.Background(), trendWindow(c), pageFromQuery(c), p.Col, p.Trends)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, models.Page{Data: posts, NextCursor: next})
+}
+
+// List the tags with more likes and comments within the requested window, no account is needed
+func (p *PostsHandler) TrendingTags(c echo.Context) error {
+	tags, next, httpErr := db.GetTrendingTags(context.Background(), trendWindow(c), pageFromQuery(c), p.Trends)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, models.Page{Data: tags, NextCursor: next})
+}
+
+// window of the trends requested with ?window=1h|24h|7d
+func trendWindow(c echo.Context) string {
+	if window := c.QueryParam("window"); window != "" {
+		return window
+	}
+
+	return db.DefaultTrendWindow
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"contacts/config"
+	"contacts/models"
+	"strconv"
+
+	"github.com/ilyakaznacheev/cleanenv"
+	"github.com/labstack/echo/v4"
+)
+
+var cfg config.Properties
+
+// init read configuration settings
+func init() {
+	if err := cleanenv.ReadEnv(&cfg); err != nil {
+		panic("Unable to read configuration")
+	}
+}
+
+// read the limit and cursor query params, the limit falls back to the default when missing or invalid
+func pageFromQuery(c echo.Context) models.PageQuery {
+	query := models.PageQuery{Limit: models.DefaultPageLimit, Cursor: c.QueryParam("cursor")}
+
+	if limit, err := strconv.Atoi(c.QueryParam("limit")); err == nil && limit > 0 {
+		query.Limit = limit
+	}
+
+	if query.Limit > models.MaxPageLimit {
+		query.Limit = models.MaxPageLimit
+	}
+
+	return query
+}
@@ -0,0 +1,13 @@
+package handlers
+
+import (
+	"contacts/keys"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Publish the public keys used to verify the tokens so other services can verify them
+func GetJWKS(c echo.Context) error {
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return c.JSON(200, keys.Default().JWKS())
+}
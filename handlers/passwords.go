@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"contacts/db"
+	"contacts/mailer"
+	"contacts/models"
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Handle forgotten password requests sending a reset token by mail.
+// Always answer the same way so the endpoint cannot be used to find registered emails
+func (u *UsersHandler) ForgotPassword(c echo.Context) error {
+	var req models.ForgotPassword
+	c.Echo().Validator = &UsersValidator{validator: v}
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(422, "Unable to parse request body")
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return c.JSON(400, "Invalid request body")
+	}
+
+	user, token, httpErr := db.CreatePasswordReset(context.Background(), req.Email, u.Col, u.Resets)
+	if httpErr != nil && httpErr.Code != 404 {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if httpErr == nil {
+		// the reset is a POST with the new password, the mail only links to a page where
+		// it can be chosen when PASSWORD_RESET_URL is set
+		link := ""
+		if cfg.PasswordResetURL != "" {
+			link = fmt.Sprintf("%s?token=%s\n\n", cfg.PasswordResetURL, url.QueryEscape(token))
+		}
+
+		err := u.Mailer.Send(mailer.Message{
+			To:      user.Email,
+			Subject: "Reset your password",
+			Body: fmt.Sprintf(
+				"Hi %s,\n\nUse this token to choose a new password, it expires in %s:\n\n%s\n\n%sIf you did not ask for it just ignore this message.",
+				user.Username, cfg.PasswordResetTTL, token, link,
+			),
+		})
+		if err != nil {
+			c.Logger().Errorf("unable to send password reset mail: %v", err)
+		}
+	}
+
+	return c.JSON(200, "If the email is registered you will receive a reset token")
+}
+
+// Handle password reset with a mailed token. All the sessions of the user are revoked
+func (u *UsersHandler) ResetPassword(c echo.Context) error {
+	var req models.ResetPassword
+	c.Echo().Validator = &UsersValidator{validator: v}
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(422, "Unable to parse request body")
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return c.JSON(400, "Invalid request body")
+	}
+
+	ctx := context.Background()
+	userID, httpErr := db.ResetPassword(ctx, req.Token, req.Password, u.Col, u.Resets)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if httpErr = db.RevokeUserSessions(ctx, userID, u.Sessions); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if httpErr = db.RevokeUserAccessTokens(ctx, userID, u.Tokens); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, "Password updated successfuly")
+}
@@ -3,7 +3,10 @@ package handlers
 import (
 	"contacts/db"
 	"contacts/models"
+	"contacts/ranking"
 	"context"
+	"encoding/json"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"go.mongodb.org/mongo-driver/bson"
@@ -12,7 +15,12 @@ import (
 
 // Post handler definition
 type PostsHandler struct {
-	Col db.CollectionAPI
+	Col       db.CollectionAPI
+	Users     db.CollectionAPI
+	Revisions db.CollectionAPI
+	Timelines db.CollectionAPI
+	Activity  db.CollectionAPI
+	Trends    db.CollectionAPI
 }
 
 // Handle requesting data and validation for posts creation
@@ -35,7 +43,7 @@ func (p *PostsHandler) CreatePost(c echo.Context) error {
 		return c.JSON(400, "Invalid request body")
 	}
 
-	result, httpErr := db.InsertPost(context.Background(), post, p.Col)
+	result, httpErr := db.InsertPost(context.Background(), post, p.Users, p.Col)
 	if httpErr != nil {
 		return c.JSON(httpErr.Code, httpErr.Message)
 	}
@@ -45,7 +53,7 @@ func (p *PostsHandler) CreatePost(c echo.Context) error {
 
 // retrieve one post
 func (p *PostsHandler) GetPost(c echo.Context) error {
-	post, httpErr := db.FindPost(context.Background(), c.Param("id"), p.Col)
+	post, httpErr := p.findVisiblePost(c, c.Param("id"))
 	if httpErr != nil {
 		return c.JSON(httpErr.Code, httpErr.Message)
 	}
@@ -53,7 +61,8 @@ func (p *PostsHandler) GetPost(c echo.Context) error {
 	return c.JSON(200, post)
 }
 
-// list posts based on users that requesting user is following
+// list posts based on users and tags that requesting user is following, latest published first or ranked
+// with ?sort=top|hot. Hot users are split between the variants of the ranking being tested
 func (p *PostsHandler) ListPosts(c echo.Context) error {
 	var user models.User
 	id := userIDFromToken(c)
@@ -62,41 +71,104 @@ func (p *PostsHandler) ListPosts(c echo.Context) error {
 		return c.JSON(500, "Unable to converto to object id")
 	}
 
+	rankingName := ""
+	switch c.QueryParam("sort") {
+	case "", "latest":
+	case "top":
+		rankingName = ranking.Top
+	case "hot":
+		rankingName = ranking.Pick(id, cfg.HotRankingVariants, ranking.Hot)
+	default:
+		return c.JSON(400, "Invalid sort")
+	}
+
 	ctx := context.Background()
 
-	usersColl, _ := db.GetConnection()
-	result := usersColl.FindOne(ctx, bson.M{"_id": docID})
+	result := p.Users.FindOne(ctx, bson.M{"_id": docID})
 	if err := result.Decode(&user); err != nil {
 		return c.JSON(500, "Something wrong happend in the request")
 	}
 
-	defer usersColl.Database().Client().Disconnect(ctx)
-	user.Following = append(user.Following, id)
-	res, httpErr := db.FindPosts(ctx, user.Following, p.Col)
+	if rankingName == "" {
+		res, next, httpErr := p.feedPage(ctx, user, pageFromQuery(c))
+		if httpErr != nil {
+			return c.JSON(httpErr.Code, httpErr.Message)
+		}
+
+		return c.JSON(200, models.Page{Data: res, NextCursor: next})
+	}
+
+	query := pageFromQuery(c)
+	rankedAt, pool, httpErr := db.RankingPool(query, cfg.RankedFeedPool)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	scorer, _ := ranking.Get(rankingName)
+	candidates, _, httpErr := p.feedPage(ctx, user, pool)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	res, next, httpErr := db.RankPosts(ctx, id, candidates, scorer, rankedAt, query, p.Col)
 	if httpErr != nil {
 		return c.JSON(httpErr.Code, httpErr.Message)
 	}
 
-	return c.JSON(200, res)
+	c.Response().Header().Set("X-Ranking-Variant", rankingName)
+	return c.JSON(200, models.Page{Data: res, NextCursor: next})
 }
 
-// handle delete product request
+// handle delete post request, the post goes to the trash of its owner and leaves the timelines and trends
 func (p *PostsHandler) RemovePost(c echo.Context) error {
-	delIDS, httpErr := db.DeletePost(context.Background(), c.Param("id"), p.Col)
-	if httpErr != nil {
+	ctx := context.Background()
+	if httpErr := db.DeletePost(ctx, c.Param("id"), userIDFromToken(c), p.Col); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if httpErr := db.RemoveTimelinePost(ctx, c.Param("id"), p.Timelines); httpErr != nil {
 		return c.JSON(httpErr.Code, httpErr.Message)
 	}
 
-	return c.JSON(200, delIDS)
+	if httpErr := db.RemovePostActivity(ctx, c.Param("id"), p.Activity); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, "Post moved to trash")
 }
 
 // Handle post update request
 func (p *PostsHandler) PostUpdate(c echo.Context) error {
-	post, httpErr := db.UpdatePost(context.Background(), c.Param("id"), c.Request().Body, p.Col)
+	ctx := context.Background()
+	previous, httpErr := db.FindPost(ctx, c.Param("id"), p.Col)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	// the fields of the request replace the ones of the stored post, the result is validated as a whole
+	post := previous
+	c.Echo().Validator = &PostsValidator{validator: v}
+
+	if err := json.NewDecoder(c.Request().Body).Decode(&post); err != nil {
+		return c.JSON(422, "Unable to parse request payload")
+	}
+
+	if err := c.Validate(&post); err != nil {
+		return c.JSON(400, "Invalid request body")
+	}
+
+	post, httpErr = db.UpdatePost(ctx, previous, post, userIDFromToken(c), p.Col, p.Revisions)
 	if httpErr != nil {
 		return c.JSON(httpErr.Code, httpErr.Message)
 	}
 
+	// a post back to draft or scheduled stops trending
+	if db.IsPublished(previous) && !db.IsPublished(post) {
+		if httpErr = db.RemovePostActivity(ctx, post.ID.Hex(), p.Activity); httpErr != nil {
+			return c.JSON(httpErr.Code, httpErr.Message)
+		}
+	}
+
 	return c.JSON(200, post)
 }
 
@@ -115,11 +187,23 @@ func (p *PostsHandler) CommentPost(c echo.Context) error {
 		return c.JSON(400, "Invalid request body")
 	}
 
-	result, httpErr := db.CreateComment(context.Background(), c.Param("id"), comment, p.Col)
+	post, httpErr := p.findVisiblePost(c, c.Param("id"))
 	if httpErr != nil {
 		return c.JSON(httpErr.Code, httpErr.Message)
 	}
 
+	ctx := context.Background()
+	result, httpErr := db.CreateComment(ctx, c.Param("id"), comment, p.Col)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	activity := models.NewActivity(models.ActivityComment, id, post, time.Now())
+	activity.CommentID = &result.Comments[len(result.Comments)-1].ID
+	if httpErr = db.RecordActivity(ctx, activity, p.Activity); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
 	return c.JSON(201, result)
 }
 
@@ -128,22 +212,116 @@ func (p *PostsHandler) DeleteComment(c echo.Context) error {
 	postID := c.Param("id")
 	commentID := c.Param("cid")
 
-	post, err := db.RemoveComment(context.Background(), postID, commentID, p.Col)
+	ctx := context.Background()
+	post, err := db.RemoveComment(ctx, postID, commentID, userIDFromToken(c), p.Col)
 	if err != nil {
 		return c.JSON(err.Code, err.Message)
 	}
 
+	if err = db.RemoveCommentActivity(ctx, commentID, p.Activity); err != nil {
+		return c.JSON(err.Code, err.Message)
+	}
+
 	return c.JSON(200, post)
 }
 
+// Handle like and unlike posts
 func (p *PostsHandler) ToggleLikePost(c echo.Context) error {
 	postID := c.Param("id")
 	userID := userIDFromToken(c)
 
-	httpErr := db.SetLike(context.Background(), userID, postID, p.Col)
+	post, httpErr := p.findVisiblePost(c, postID)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	ctx := context.Background()
+	liked, httpErr := db.SetLike(ctx, userID, postID, p.Col)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if liked {
+		httpErr = db.RecordActivity(ctx, models.NewActivity(models.ActivityLike, userID, post, time.Now()), p.Activity)
+	} else {
+		httpErr = db.RemoveLikeActivity(ctx, postID, userID, p.Activity)
+	}
 	if httpErr != nil {
 		return c.JSON(httpErr.Code, httpErr.Message)
 	}
 
 	return c.JSON(200, "request was successfully")
 }
+
+// Handle publishing now a draft or scheduled post
+func (p *PostsHandler) PublishPost(c echo.Context) error {
+	post, httpErr := db.PublishPost(context.Background(), c.Param("id"), p.Col)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, post)
+}
+
+// List the drafts and scheduled posts of the requesting user
+func (p *PostsHandler) ListDrafts(c echo.Context) error {
+	posts, next, httpErr := db.GetDrafts(context.Background(), userIDFromToken(c), pageFromQuery(c), p.Col)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, models.Page{Data: posts, NextCursor: next})
+}
+
+// retrieve the post if the requesting user can see it. Unpublished posts of other users, posts
+// of users that blocked it and of private users it does not follow are not found
+func (p *PostsHandler) findVisiblePost(c echo.Context, id string) (models.Post, *echo.HTTPError) {
+	ctx := context.Background()
+
+	post, httpErr := db.FindPost(ctx, id, p.Col)
+	if httpErr != nil {
+		return post, httpErr
+	}
+
+	if !db.IsPublished(post) && post.From != userIDFromToken(c) {
+		return post, echo.NewHTTPError(404, "Post not found")
+	}
+
+	visible, httpErr := db.CanViewAuthor(ctx, userIDFromToken(c), post.From, p.Users)
+	if httpErr != nil {
+		return post, httpErr
+	}
+
+	if !visible {
+		return post, echo.NewHTTPError(404, "Post not found")
+	}
+
+	return post, nil
+}
+
+// get a page of the feed of the user latest published first. The feed is read from the timeline
+// of the user, users without one yet get it built from the posts meanwhile
+func (p *PostsHandler) feedPage(ctx context.Context, user models.User, query models.PageQuery) ([]models.Post, string, *echo.HTTPError) {
+	var hidden []string
+	var httpErr *echo.HTTPError
+	if len(user.FollowedTags) > 0 {
+		if hidden, httpErr = db.HiddenAuthors(ctx, user, p.Users); httpErr != nil {
+			return nil, "", httpErr
+		}
+	}
+
+	if user.TimelineReady {
+		return db.ReadTimeline(ctx, user, hidden, query, p.Users, p.Col, p.Timelines)
+	}
+
+	if httpErr = db.RequestTimelineRebuild(ctx, user, p.Users); httpErr != nil {
+		return nil, "", httpErr
+	}
+
+	authors, httpErr := db.FeedAuthors(ctx, user, p.Users)
+	if httpErr != nil {
+		return nil, "", httpErr
+	}
+
+	return db.FindPosts(ctx, user, authors, user.FollowedTags, hidden, query, p.Col)
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"contacts/db"
+	"contacts/models"
+	"context"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Handle profile updates of the requesting user
+func (u *UsersHandler) UpdateProfile(c echo.Context) error {
+	var req models.ProfileUpdate
+	c.Echo().Validator = &UsersValidator{validator: v}
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(422, "Unable to parse request body")
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return c.JSON(400, "Invalid request body")
+	}
+
+	ctx := context.Background()
+	user, httpErr := db.UpdateProfile(ctx, userIDFromToken(c), req, u.Col)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if req.Private != nil {
+		if httpErr = db.SetAuthorPrivacy(ctx, user.ID.Hex(), user.Private, u.Posts, u.Activity); httpErr != nil {
+			return c.JSON(httpErr.Code, httpErr.Message)
+		}
+	}
+
+	return c.JSON(200, user.PublicProfile())
+}
+
+// Handle password change of the requesting user. Other devices are signed out
+func (u *UsersHandler) ChangePassword(c echo.Context) error {
+	var req models.PasswordChange
+	c.Echo().Validator = &UsersValidator{validator: v}
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(422, "Unable to parse request body")
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return c.JSON(400, "Invalid request body")
+	}
+
+	ctx := context.Background()
+	userID := userIDFromToken(c)
+	if httpErr := db.ChangePassword(ctx, userID, req, u.Col); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if _, httpErr := db.RevokeOtherSessions(ctx, userID, sessionIDFromToken(c), u.Sessions); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if httpErr := db.RevokeUserAccessTokens(ctx, userID, u.Tokens); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, "Password updated successfuly")
+}
+
+// Handle email change of the requesting user. The new email is used once verified
+func (u *UsersHandler) ChangeEmail(c echo.Context) error {
+	var req models.EmailChange
+	c.Echo().Validator = &UsersValidator{validator: v}
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(422, "Unable to parse request body")
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return c.JSON(400, "Invalid request body")
+	}
+
+	user, httpErr := db.RequestEmailChange(context.Background(), userIDFromToken(c), req, u.Col)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if httpErr = u.sendVerification(user.ID.Hex(), user.Username, user.PendingEmail); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, "Verification mail sent to the new email")
+}
+
+// Handle account deletion of the requesting user. The account is removed once the grace period is over
+func (u *UsersHandler) DeleteAccount(c echo.Context) error {
+	var req models.AccountDeletion
+	c.Echo().Validator = &UsersValidator{validator: v}
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(422, "Unable to parse request body")
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return c.JSON(400, "Invalid request body")
+	}
+
+	dueAt, httpErr := db.ScheduleAccountDeletion(context.Background(), userIDFromToken(c), req.Password, u.deletionCollections())
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, echo.Map{"deletion_due_at": dueAt})
+}
+
+// collections with data of the users
+func (u *UsersHandler) deletionCollections() db.DeletionCollections {
+	return db.DeletionCollections{
+		Users:         u.Col,
+		Posts:         u.Posts,
+		Sessions:      u.Sessions,
+		Resets:        u.Resets,
+		Verifications: u.Verifications,
+		Tokens:        u.Tokens,
+		Timelines:     u.Timelines,
+		Activity:      u.Activity,
+	}
+}
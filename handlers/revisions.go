@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"contacts/db"
+	"contacts/models"
+	"context"
+
+	"github.com/labstack/echo/v4"
+)
+
+// List the revisions of a post
+func (p *PostsHandler) ListRevisions(c echo.Context) error {
+	if _, httpErr := p.findVisiblePost(c, c.Param("id")); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	revisions, next, httpErr := db.ListRevisions(context.Background(), c.Param("id"), pageFromQuery(c), p.Revisions)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, models.Page{Data: revisions, NextCursor: next})
+}
+
+// Retrieve a revision of a post with the diff against the current version
+func (p *PostsHandler) GetRevision(c echo.Context) error {
+	post, httpErr := p.findVisiblePost(c, c.Param("id"))
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	revision, httpErr := db.FindRevision(context.Background(), c.Param("id"), c.Param("rev"), p.Revisions)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, db.DiffRevision(revision, post))
+}
+
+// Handle restoring the content of a revision to the post
+func (p *PostsHandler) RestoreRevision(c echo.Context) error {
+	post, httpErr := db.RestoreRevision(context.Background(), c.Param("id"), c.Param("rev"), userIDFromToken(c), p.Col, p.Revisions)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, post)
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"contacts/db"
+	"contacts/middlewares"
+	"contacts/models"
+	"contacts/search"
+	"context"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Search handler definition. Any search engine can be plugged in
+type SearchHandler struct {
+	Engine search.Engine
+	Users  db.CollectionAPI
+}
+
+// Search posts, comments or users with ?q= and ?type=posts|comments|users, posts by default.
+// Results the requesting user can not see are left out
+func (s *SearchHandler) Search(c echo.Context) error {
+	raw := c.QueryParam("q")
+	if utf8.RuneCountInString(raw) > search.MaxQueryLength {
+		return c.JSON(400, "Search query is too long")
+	}
+
+	q := search.Parse(raw)
+	if q.Empty() {
+		return c.JSON(400, "Missing search query")
+	}
+
+	scope := models.ScopePostsRead
+	searchType := c.QueryParam("type")
+	switch searchType {
+	case "":
+		searchType = "posts"
+	case "posts", "comments":
+	case "users":
+		scope = models.ScopeUsersRead
+	default:
+		return c.JSON(400, "Invalid search type")
+	}
+
+	if !middlewares.HasScope(c, scope) {
+		return c.JSON(403, "Token is missing the "+scope+" scope")
+	}
+
+	ctx := context.Background()
+	viewer, httpErr := db.FindUser(ctx, userIDFromToken(c), s.Users)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	var hits interface{}
+	var next string
+	switch searchType {
+	case "posts":
+		hits, next, httpErr = s.Engine.SearchPosts(ctx, q, viewer, pageFromQuery(c))
+	case "comments":
+		hits, next, httpErr = s.Engine.SearchComments(ctx, q, viewer, pageFromQuery(c))
+	case "users":
+		hits, next, httpErr = s.Engine.SearchUsers(ctx, q, viewer, pageFromQuery(c))
+	}
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, models.Page{Data: hits, NextCursor: next})
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"contacts/db"
+	"contacts/models"
+	"context"
+
+	"github.com/labstack/echo/v4"
+)
+
+// List the users suggested for the requesting user to follow
+func (u *UsersHandler) GetSuggestions(c echo.Context) error {
+	suggestions, next, httpErr := db.GetSuggestions(context.Background(), userIDFromToken(c), pageFromQuery(c), u.Col, u.Posts)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, models.Page{Data: suggestions, NextCursor: next})
+}
+
+// Stop suggesting a user to the requesting user
+func (u *UsersHandler) DismissSuggestion(c echo.Context) error {
+	if httpErr := db.DismissSuggestion(context.Background(), userIDFromToken(c), c.Param("id"), u.Col); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, "Suggestion dismissed successfuly")
+}
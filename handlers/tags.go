@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"contacts/db"
+	"contacts/models"
+	"context"
+
+	"github.com/labstack/echo/v4"
+)
+
+// List the tags used by the posts with their usage count
+func (p *PostsHandler) ListTags(c echo.Context) error {
+	tags, next, httpErr := db.ListTags(context.Background(), pageFromQuery(c), p.Col)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, models.Page{Data: tags, NextCursor: next})
+}
+
+// List the posts with a tag that the requesting user can see
+func (p *PostsHandler) GetTagPosts(c echo.Context) error {
+	tag, ok := db.NormalizeTag(c.Param("tag"))
+	if !ok {
+		return c.JSON(400, "Invalid tag")
+	}
+
+	ctx := context.Background()
+	user, httpErr := db.FindUser(ctx, userIDFromToken(c), p.Users)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	hidden, httpErr := db.HiddenAuthors(ctx, user, p.Users)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	posts, next, httpErr := db.FindTagPosts(ctx, tag, user, hidden, pageFromQuery(c), p.Col)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, models.Page{Data: posts, NextCursor: next})
+}
+
+// Handle following and unfollowing tags
+func (p *PostsHandler) FollowTag(c echo.Context) error {
+	tag, ok := db.NormalizeTag(c.Param("tag"))
+	if !ok {
+		return c.JSON(400, "Invalid tag")
+	}
+
+	followed, httpErr := db.ToggleTagFollow(context.Background(), userIDFromToken(c), tag, p.Users)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if !followed {
+		return c.JSON(200, echo.Map{"status": "unfollowed"})
+	}
+
+	return c.JSON(200, echo.Map{"status": "followed"})
+}
+
+// List the tags followed by the requesting user
+func (p *PostsHandler) GetFollowedTags(c echo.Context) error {
+	tags, next, httpErr := db.GetFollowedTags(context.Background(), userIDFromToken(c), pageFromQuery(c), p.Users)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, models.Page{Data: tags, NextCursor: next})
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"contacts/db"
+	"contacts/models"
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/labstack/echo/v4"
+)
+
+// check the login throttles and return a 429 error, setting Retry-After, if any is blocked.
+// Blocked attempts are recorded too
+func (u *UsersHandler) checkLoginThrottle(c echo.Context, username, step string, keys map[string]int) *echo.HTTPError {
+	ctx := context.Background()
+
+	names := make([]string, 0, len(keys))
+	for key := range keys {
+		names = append(names, key)
+	}
+
+	wait, httpErr := db.CheckLoginThrottle(ctx, names, u.Throttles)
+	if httpErr != nil {
+		return httpErr
+	}
+
+	if wait <= 0 {
+		return nil
+	}
+
+	u.recordLoginAttempt(c, models.LoginAttempt{Username: username, Step: step, Blocked: true})
+	c.Response().Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(wait.Seconds()))))
+	return echo.NewHTTPError(429, "Too many failed attempts, try again later")
+}
+
+// record the login attempt and update the throttles with its result.
+// A success only resets the account throttle so a valid account can not unlock an ip
+func (u *UsersHandler) registerLoginResult(c echo.Context, username, step string, keys map[string]int, accountKey string, failed bool) {
+	ctx := context.Background()
+	u.recordLoginAttempt(c, models.LoginAttempt{Username: username, Step: step, Success: !failed})
+
+	if !failed {
+		if httpErr := db.ResetLoginThrottle(ctx, accountKey, u.Throttles); httpErr != nil {
+			c.Logger().Errorf("unable to reset login throttle: %v", httpErr.Message)
+		}
+		return
+	}
+
+	for key, threshold := range keys {
+		if httpErr := db.RegisterLoginFailure(ctx, key, threshold, u.Throttles); httpErr != nil {
+			c.Logger().Errorf("unable to register login failure: %v", httpErr.Message)
+		}
+	}
+}
+
+// record the attempt with the request data
+func (u *UsersHandler) recordLoginAttempt(c echo.Context, attempt models.LoginAttempt) {
+	attempt.IP = c.RealIP()
+	attempt.UserAgent = c.Request().UserAgent()
+
+	if httpErr := db.RecordLoginAttempt(context.Background(), attempt, u.Attempts); httpErr != nil {
+		c.Logger().Errorf("unable to record login attempt: %v", httpErr.Message)
+	}
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"contacts/db"
+	"contacts/models"
+	"context"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Create a personal access token for the requesting user. The token is only shown in this response
+func (u *UsersHandler) CreateAccessToken(c echo.Context) error {
+	var req models.NewAccessToken
+	c.Echo().Validator = &UsersValidator{validator: v}
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(422, "Unable to parse request body")
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return c.JSON(400, "Invalid request body")
+	}
+
+	accessToken, token, httpErr := db.CreateAccessToken(context.Background(), userIDFromToken(c), req, u.Tokens)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(201, echo.Map{"token": token, "details": accessToken})
+}
+
+// List the personal access tokens of the requesting user
+func (u *UsersHandler) ListAccessTokens(c echo.Context) error {
+	tokens, next, httpErr := db.ListAccessTokens(context.Background(), userIDFromToken(c), pageFromQuery(c), u.Tokens)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, models.Page{Data: tokens, NextCursor: next})
+}
+
+// Revoke one personal access token of the requesting user
+func (u *UsersHandler) RevokeAccessToken(c echo.Context) error {
+	httpErr := db.RevokeAccessToken(context.Background(), userIDFromToken(c), c.Param("tid"), u.Tokens)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, "Token revoked successfuly")
+}
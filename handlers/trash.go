@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"contacts/db"
+	"contacts/models"
+	"context"
+
+	"github.com/labstack/echo/v4"
+)
+
+// List the posts in the trash of the requesting user
+func (p *PostsHandler) GetTrash(c echo.Context) error {
+	posts, next, httpErr := db.GetTrash(context.Background(), userIDFromToken(c), pageFromQuery(c), p.Col)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, models.Page{Data: posts, NextCursor: next})
+}
+
+// List the comments in the trash of the requesting user
+func (p *PostsHandler) GetTrashedComments(c echo.Context) error {
+	comments, next, httpErr := db.GetTrashedComments(context.Background(), userIDFromToken(c), pageFromQuery(c), p.Col)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, models.Page{Data: comments, NextCursor: next})
+}
+
+// Handle restoring a post from the trash
+func (p *PostsHandler) RestorePost(c echo.Context) error {
+	post, httpErr := db.RestorePost(context.Background(), c.Param("id"), userIDFromToken(c), p.Col)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, post)
+}
+
+// Handle restoring a comment from the trash
+func (p *PostsHandler) RestoreComment(c echo.Context) error {
+	post, httpErr := db.RestoreComment(context.Background(), c.Param("id"), c.Param("cid"), userIDFromToken(c), p.Col)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, post)
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"contacts/db"
+	"contacts/middlewares"
+	"contacts/models"
+	"contacts/totp"
+	"context"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Start two factor enrollment returning the secret and the otpauth uri for the authenticator app
+func (u *UsersHandler) SetupTOTP(c echo.Context) error {
+	ctx := context.Background()
+	user, httpErr := db.FindUser(ctx, userIDFromToken(c), u.Col)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return c.JSON(500, "Unable to create secret")
+	}
+
+	if httpErr = db.SetPendingTOTP(ctx, user.ID.Hex(), secret, u.Col); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, echo.Map{
+		"secret": secret,
+		"uri":    totp.URI(cfg.TOTPIssuer, user.Username, secret),
+	})
+}
+
+// Finish two factor enrollment with a code of the authenticator app. The recovery codes are only shown here
+func (u *UsersHandler) ConfirmTOTP(c echo.Context) error {
+	var req models.TOTPConfirm
+	c.Echo().Validator = &UsersValidator{validator: v}
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(422, "Unable to parse request body")
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return c.JSON(400, "Invalid request body")
+	}
+
+	codes, httpErr := db.ConfirmTOTP(context.Background(), userIDFromToken(c), req.Code, u.Col)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, echo.Map{"recovery_codes": codes})
+}
+
+// Handle the second step of the login exchanging the challenge and a code for the tokens
+func (u *UsersHandler) LoginSecondFactor(c echo.Context) error {
+	var req models.SecondFactor
+	c.Echo().Validator = &UsersValidator{validator: v}
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(422, "Unable to parse request body")
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return c.JSON(400, "Invalid request body")
+	}
+
+	_, claims, err := middlewares.ParseChallengeToken(req.Challenge)
+	if err != nil {
+		return c.JSON(401, "Invalid or expired challenge")
+	}
+
+	userID, _ := claims["user_id"].(string)
+	accountKey := models.ThrottleKey(models.ThrottleTwoFactor, userID)
+	keys := map[string]int{
+		accountKey: cfg.LoginAccountThreshold,
+		models.ThrottleKey(models.ThrottleIP, c.RealIP()): cfg.LoginIPThreshold,
+	}
+
+	if httpErr := u.checkLoginThrottle(c, userID, "2fa", keys); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	user, httpErr := db.VerifySecondFactor(context.Background(), userID, req.Code, req.RecoveryCode, u.Col)
+	u.registerLoginResult(c, user.Username, "2fa", keys, accountKey, httpErr != nil && httpErr.Code == 400)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if httpErr = u.startSession(c, user); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, user.Username)
+}
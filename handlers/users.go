@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"contacts/db"
+	"contacts/mailer"
 	"contacts/middlewares"
 	"contacts/models"
 	"context"
@@ -12,7 +13,17 @@ import (
 
 // User handler definition
 type UsersHandler struct {
-	Col db.CollectionAPI
+	Col           db.CollectionAPI
+	Posts         db.CollectionAPI
+	Sessions      db.CollectionAPI
+	Resets        db.CollectionAPI
+	Verifications db.CollectionAPI
+	Tokens        db.CollectionAPI
+	Throttles     db.CollectionAPI
+	Attempts      db.CollectionAPI
+	Timelines     db.CollectionAPI
+	Activity      db.CollectionAPI
+	Mailer        mailer.Mailer
 }
 
 // Handle users signup and validate request body
@@ -33,6 +44,11 @@ func (u *UsersHandler) Signup(c echo.Context) error {
 		return c.JSON(httpErr.Code, httpErr.Message)
 	}
 
+	userID := result.InsertedID.(primitive.ObjectID).Hex()
+	if httpErr = u.sendVerification(userID, user.Username, user.Email); httpErr != nil {
+		c.Logger().Errorf("unable to send verification mail: %v", httpErr.Message)
+	}
+
 	return c.JSON(201, result)
 }
 
@@ -44,23 +60,132 @@ func (u *UsersHandler) Login(c echo.Context) error {
 		return c.JSON(422, "Unable to parse request body")
 	}
 
+	accountKey := models.ThrottleKey(models.ThrottleUser, user.Username)
+	keys := map[string]int{
+		accountKey: cfg.LoginAccountThreshold,
+		models.ThrottleKey(models.ThrottleIP, c.RealIP()): cfg.LoginIPThreshold,
+	}
+
+	if httpErr := u.checkLoginThrottle(c, user.Username, "password", keys); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
 	logUser, httpErr := db.LoginUser(context.Background(), user, u.Col)
+	u.registerLoginResult(c, user.Username, "password", keys, accountKey, httpErr != nil && httpErr.Code == 400)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if logUser.TOTPEnabled {
+		challenge, httpErr := logUser.GenerateChallengeToken()
+		if httpErr != nil {
+			return c.JSON(httpErr.Code, httpErr.Message)
+		}
+
+		return c.JSON(200, echo.Map{"two_factor_required": true, "challenge": challenge})
+	}
+
+	if httpErr = u.startSession(c, logUser); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, user.Username)
+}
+
+// open a session for the user once every login step passed and set the access and refresh tokens
+// in the response headers. Logging in cancels the scheduled deletion of the account
+func (u *UsersHandler) startSession(c echo.Context, user models.User) *echo.HTTPError {
+	if user.DeletionDueAt != nil {
+		if httpErr := db.CancelAccountDeletion(context.Background(), user, u.Col); httpErr != nil {
+			return httpErr
+		}
+	}
+
+	session, refreshToken, httpErr := db.CreateSession(context.Background(), user.ID.Hex(), c.Request().UserAgent(), c.RealIP(), u.Sessions)
+	if httpErr != nil {
+		return httpErr
+	}
+
+	token, httpErr := user.GenerateToken(session.ID.Hex())
+	if httpErr != nil {
+		return httpErr
+	}
+
+	c.Response().Header().Add("x-auth-token", "Bearer "+token)
+	c.Response().Header().Add("x-refresh-token", refreshToken)
+	return nil
+}
+
+// Handle logout revoking the session of the access token
+func (u *UsersHandler) Logout(c echo.Context) error {
+	httpErr := db.RevokeSession(context.Background(), userIDFromToken(c), sessionIDFromToken(c), u.Sessions)
 	if httpErr != nil {
 		return c.JSON(httpErr.Code, httpErr.Message)
 	}
 
-	token, httpErr := logUser.GenerateToken()
+	return c.JSON(200, "Logged out successfuly")
+}
+
+// Handle exchange of a refresh token for a new access token and refresh token
+func (u *UsersHandler) RefreshToken(c echo.Context) error {
+	refreshToken := c.Request().Header.Get("x-refresh-token")
+	if refreshToken == "" {
+		return c.JSON(400, "Missing refresh token")
+	}
+
+	session, newRefreshToken, httpErr := db.RotateSession(context.Background(), refreshToken, c.RealIP(), u.Sessions)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	user, httpErr := db.FindUser(context.Background(), session.UserID, u.Col)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	token, httpErr := user.GenerateToken(session.ID.Hex())
 	if httpErr != nil {
 		return c.JSON(httpErr.Code, httpErr.Message)
 	}
 
 	c.Response().Header().Add("x-auth-token", "Bearer "+token)
-	return c.JSON(200, user.Username)
+	c.Response().Header().Add("x-refresh-token", newRefreshToken)
+	return c.JSON(200, "Token refreshed successfuly")
+}
+
+// List the devices where the requesting user is signed in
+func (u *UsersHandler) ListSessions(c echo.Context) error {
+	sessions, next, httpErr := db.ListUserSessions(context.Background(), userIDFromToken(c), sessionIDFromToken(c), pageFromQuery(c), u.Sessions)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, models.Page{Data: sessions, NextCursor: next})
+}
+
+// Sign out one device of the requesting user
+func (u *UsersHandler) RevokeSession(c echo.Context) error {
+	httpErr := db.RevokeSession(context.Background(), userIDFromToken(c), c.Param("sid"), u.Sessions)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, "Session revoked successfuly")
 }
 
-// Handle retrieve user info. Only return the email
+// Sign out every device of the requesting user except the current one
+func (u *UsersHandler) RevokeOtherSessions(c echo.Context) error {
+	revoked, httpErr := db.RevokeOtherSessions(context.Background(), userIDFromToken(c), sessionIDFromToken(c), u.Sessions)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, echo.Map{"revoked": revoked})
+}
+
+// Handle retrieve user info. Only return the public profile
 func (u *UsersHandler) GetUser(c echo.Context) error {
-	user, httpErr := db.RetrieveUser(context.Background(), c.Param("id"), u.Col)
+	user, httpErr := db.RetrieveUser(context.Background(), c.Param("id"), u.Col, u.Posts)
 	if httpErr != nil {
 		return c.JSON(httpErr.Code, httpErr.Message)
 	}
@@ -70,27 +195,72 @@ func (u *UsersHandler) GetUser(c echo.Context) error {
 
 // Get users followers
 func (u *UsersHandler) GetFollowers(c echo.Context) error {
+	return u.listConnections(c, db.GetUserFollowers)
+}
+
+// Retrieve the users followed by the user by id
+func (u *UsersHandler) GetFollowing(c echo.Context) error {
+	return u.listConnections(c, db.GetUserFollowing)
+}
+
+// Retrieve the users that follow the user by id and are followed back
+func (u *UsersHandler) GetMutuals(c echo.Context) error {
+	return u.listConnections(c, db.GetMutualFollows)
+}
+
+// Retrieve how the user by id relates to the other user
+func (u *UsersHandler) GetRelationship(c echo.Context) error {
+	relationship, httpErr := db.GetRelationship(context.Background(), c.Param("id"), c.Param("other"), userIDFromToken(c), u.Col)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, relationship)
+}
+
+// list a page of the connections of the user by id, hidden when the user is not visible to the requesting user
+func (u *UsersHandler) listConnections(c echo.Context, list func(context.Context, primitive.ObjectID, models.PageQuery, db.CollectionAPI) ([]models.PublicProfile, string, *echo.HTTPError)) error {
+	ctx := context.Background()
 	id, err := primitive.ObjectIDFromHex(c.Param("id"))
 	if err != nil {
-		return c.JSON(500, "Unable to convert to object id")
+		return c.JSON(400, "Unable to convert to object id")
+	}
+
+	visible, httpErr := db.CanViewAuthor(ctx, userIDFromToken(c), id.Hex(), u.Col)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
 	}
 
-	users, httpErr := db.GetUserFollowers(context.Background(), id, u.Col)
+	if !visible {
+		return c.JSON(403, "The connections of this user are not visible to you")
+	}
+
+	users, next, httpErr := list(ctx, id, pageFromQuery(c), u.Col)
 	if httpErr != nil {
 		return c.JSON(httpErr.Code, httpErr.Message)
 	}
 
-	return c.JSON(200, users)
+	return c.JSON(200, models.Page{Data: users, NextCursor: next})
 }
 
 // Retrieve the posts from user by id
 func (u *UsersHandler) GetUserPosts(c echo.Context) error {
-	posts, httpErr := db.RetrievetUserPosts(context.Background(), c.Param("id"), u.Col)
+	ctx := context.Background()
+	visible, httpErr := db.CanViewAuthor(ctx, userIDFromToken(c), c.Param("id"), u.Col)
 	if httpErr != nil {
 		return c.JSON(httpErr.Code, httpErr.Message)
 	}
 
-	return c.JSON(200, posts)
+	if !visible {
+		return c.JSON(403, "The posts of this user are not visible to you")
+	}
+
+	posts, next, httpErr := db.RetrievetUserPosts(ctx, c.Param("id"), c.Param("id") == userIDFromToken(c), pageFromQuery(c), u.Posts)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, models.Page{Data: posts, NextCursor: next})
 }
 
 // Handle following users
@@ -98,11 +268,19 @@ func (u *UsersHandler) FollowUser(c echo.Context) error {
 	toID := c.Param("id")
 	fromID := userIDFromToken(c)
 
-	if err := db.SetFollowUser(context.Background(), fromID, toID, u.Col); err != nil {
+	ctx := context.Background()
+	status, err := db.SetFollowUser(ctx, fromID, toID, u.Col)
+	if err != nil {
 		return c.JSON(err.Code, err.Message)
 	}
 
-	return c.JSON(200, "User followed successfuly")
+	if status == db.FollowUnfollowed {
+		if err = db.RemoveTimelineAuthor(ctx, fromID, toID, u.Timelines); err != nil {
+			return c.JSON(err.Code, err.Message)
+		}
+	}
+
+	return c.JSON(200, echo.Map{"status": status})
 }
 
 // Get user id from token
@@ -110,3 +288,10 @@ func userIDFromToken(c echo.Context) string {
 	_, claims := middlewares.GetToken(c)
 	return claims["user_id"].(string)
 }
+
+// Get session id from token
+func sessionIDFromToken(c echo.Context) string {
+	_, claims := middlewares.GetToken(c)
+	sessionID, _ := claims["sid"].(string)
+	return sessionID
+}
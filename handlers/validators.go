@@ -1,9 +1,31 @@
 package handlers
 
-import "gopkg.in/go-playground/validator.v9"
+import (
+	"net/url"
+
+	"gopkg.in/go-playground/validator.v9"
+)
 
 var v = validator.New()
 
+// register the validations of the app
+func init() {
+	if err := v.RegisterValidation("http_url", isHTTPURL); err != nil {
+		panic("Unable to register validations")
+	}
+}
+
+// check the field is an absolute http or https url, other schemes like javascript: or data:
+// are rejected since the urls are rendered as links and images
+func isHTTPURL(fl validator.FieldLevel) bool {
+	parsed, err := url.Parse(fl.Field().String())
+	if err != nil {
+		return false
+	}
+
+	return (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
 type UsersValidator struct {
 	validator *validator.Validate
 }
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"contacts/db"
+	"contacts/mailer"
+	"context"
+	"fmt"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Handle email verification with the token sent by mail
+func (u *UsersHandler) VerifyEmail(c echo.Context) error {
+	token := c.QueryParam("token")
+	if token == "" {
+		return c.JSON(400, "Missing verification token")
+	}
+
+	if httpErr := db.VerifyEmail(context.Background(), token, u.Col, u.Verifications); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, "Email verified successfuly")
+}
+
+// Handle requests to send the verification mail again
+func (u *UsersHandler) ResendVerification(c echo.Context) error {
+	user, httpErr := db.FindUser(context.Background(), userIDFromToken(c), u.Col)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if user.Verified {
+		return c.JSON(400, "Email already verified")
+	}
+
+	if httpErr = u.sendVerification(user.ID.Hex(), user.Username, user.Email); httpErr != nil {
+		if httpErr.Code == 429 {
+			c.Response().Header().Set("Retry-After", fmt.Sprintf("%.0f", cfg.VerificationResendWait.Seconds()))
+		}
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return c.JSON(200, "Verification mail sent")
+}
+
+// create a verification token for the email and mail it
+func (u *UsersHandler) sendVerification(userID, username, email string) *echo.HTTPError {
+	token, httpErr := db.CreateVerification(context.Background(), userID, email, u.Verifications)
+	if httpErr != nil {
+		return httpErr
+	}
+
+	err := u.Mailer.Send(mailer.Message{
+		To:      email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nOpen this link to verify your email, it expires in %s:\n\n%s/users/verify?token=%s",
+			username, cfg.VerificationTTL, cfg.AppURL, token,
+		),
+	})
+	if err != nil {
+		return echo.NewHTTPError(500, "Unable to send verification mail")
+	}
+
+	return nil
+}
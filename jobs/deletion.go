@@ -0,0 +1,53 @@
+package jobs
+
+import (
+	"contacts/db"
+	"context"
+	"log"
+	"time"
+)
+
+// time a claimed deletion is locked for an instance before others can resume it
+const deletionLock = 10 * time.Minute
+
+// AccountDeleter removes the accounts whose deletion grace period is over
+type AccountDeleter struct {
+	Cols     db.DeletionCollections
+	Interval time.Duration
+}
+
+// Run the deleter until the context is canceled
+func (d *AccountDeleter) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+
+	for {
+		d.deleteDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// delete every due account, one at a time
+func (d *AccountDeleter) deleteDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		user, found, err := db.ClaimDueDeletion(ctx, deletionLock, d.Cols.Users)
+		if err != nil {
+			log.Printf("unable to claim account deletion: %v", err)
+			return
+		}
+
+		if !found {
+			return
+		}
+
+		if err = db.DeleteAccount(ctx, user, d.Cols); err != nil {
+			log.Printf("unable to delete account %s, it will be resumed: %v", user.ID.Hex(), err)
+			return
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package jobs
+
+import (
+	"contacts/db"
+	"context"
+	"log"
+	"time"
+)
+
+// time a claimed post or timeline is locked for an instance before others can retry it
+const fanoutLock = 5 * time.Minute
+
+// FanOut delivers the published posts to the timelines of the followers of their authors
+// and backfills the timelines of the users that followed someone new
+type FanOut struct {
+	Users     db.CollectionAPI
+	Posts     db.CollectionAPI
+	Timelines db.CollectionAPI
+	Interval  time.Duration
+}
+
+// Run the fan-out until the context is canceled
+func (f *FanOut) Run(ctx context.Context) {
+	ticker := time.NewTicker(f.Interval)
+	defer ticker.Stop()
+
+	for {
+		f.fanOutPending(ctx)
+		f.backfillPending(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// fan out every pending post, one at a time
+func (f *FanOut) fanOutPending(ctx context.Context) {
+	for ctx.Err() == nil {
+		post, found, err := db.ClaimPendingFanout(ctx, fanoutLock, f.Posts)
+		if err != nil {
+			log.Printf("unable to claim post fan-out: %v", err)
+			return
+		}
+
+		if !found {
+			return
+		}
+
+		if err = db.FanOutPost(ctx, post, f.Users, f.Posts, f.Timelines); err != nil {
+			log.Printf("unable to fan out post %s, it will be retried: %v", post.ID.Hex(), err)
+			return
+		}
+	}
+}
+
+// backfill every pending timeline, one at a time
+func (f *FanOut) backfillPending(ctx context.Context) {
+	for ctx.Err() == nil {
+		user, found, err := db.ClaimTimelineBackfill(ctx, fanoutLock, f.Users)
+		if err != nil {
+			log.Printf("unable to claim timeline backfill: %v", err)
+			return
+		}
+
+		if !found {
+			return
+		}
+
+		if err = db.BackfillTimeline(ctx, user, f.Users, f.Posts, f.Timelines); err != nil {
+			log.Printf("unable to backfill timeline of %s, it will be retried: %v", user.ID.Hex(), err)
+			return
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package jobs
+
+import (
+	"contacts/db"
+	"context"
+	"log"
+	"time"
+)
+
+// Publisher publishes the scheduled posts once their publish date is due
+type Publisher struct {
+	Posts    db.CollectionAPI
+	Interval time.Duration
+}
+
+// Run the publisher until the context is canceled
+func (p *Publisher) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for {
+		p.publishDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// publish every due post, one at a time
+func (p *Publisher) publishDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		_, found, err := db.PublishDuePost(ctx, p.Posts)
+		if err != nil {
+			log.Printf("unable to publish scheduled post: %v", err)
+			return
+		}
+
+		if !found {
+			return
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package jobs
+
+import (
+	"contacts/db"
+	"context"
+	"log"
+	"time"
+)
+
+// Purger removes for good the posts and comments whose retention in the trash is over
+type Purger struct {
+	Posts     db.CollectionAPI
+	Revisions db.CollectionAPI
+	Interval  time.Duration
+}
+
+// Run the purger until the context is canceled
+func (p *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for {
+		p.purge(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purge the expired comments and every expired post, one at a time
+func (p *Purger) purge(ctx context.Context) {
+	if err := db.PurgeDeletedComments(ctx, p.Posts); err != nil {
+		log.Printf("unable to purge deleted comments: %v", err)
+	}
+
+	for ctx.Err() == nil {
+		found, err := db.PurgeDeletedPost(ctx, p.Posts, p.Revisions)
+		if err != nil {
+			log.Printf("unable to purge deleted post: %v", err)
+			return
+		}
+
+		if !found {
+			return
+		}
+	}
+}
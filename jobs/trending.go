@@ -0,0 +1,33 @@
+package jobs
+
+import (
+	"contacts/db"
+	"context"
+	"log"
+	"time"
+)
+
+// TrendingAggregator refreshes the trending posts and tags from the recent activity
+type TrendingAggregator struct {
+	Activity db.CollectionAPI
+	Trends   db.CollectionAPI
+	Interval time.Duration
+}
+
+// Run the aggregator until the context is canceled
+func (t *TrendingAggregator) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := db.ComputeTrends(ctx, t.Activity, t.Trends); err != nil {
+			log.Printf("unable to compute trends: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
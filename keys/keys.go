@@ -0,0 +1,246 @@
+package keys
+
+import (
+	"contacts/config"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/ilyakaznacheev/cleanenv"
+)
+
+// Key definition. Keys loaded from a public key file can only verify tokens
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+	Public  crypto.PublicKey
+}
+
+// KeySet holds every key accepted to verify tokens and the one used to sign new tokens.
+//
+// Rotation: add the new key to the directory of every instance pinning the signing key with
+// JWT_SIGNING_KEY_ID to the old one, then move the pin (or remove it) to the new key. Keep the
+// old key, or only its public key, until the tokens it signed expired and then delete it
+type KeySet struct {
+	keys    map[string]*Key
+	signing *Key
+}
+
+var (
+	defaultSet  *KeySet
+	defaultOnce sync.Once
+)
+
+// Get the key set configured by JWT_KEYS_DIR and JWT_SIGNING_KEY_ID, loaded once per process.
+// When the directory has no keys the process panics, unless JWT_EPHEMERAL_KEY allows generating
+// an ephemeral key for development
+func Default() *KeySet {
+	defaultOnce.Do(func() {
+		var cfg config.Properties
+		if err := cleanenv.ReadEnv(&cfg); err != nil {
+			panic("Unable to read configuration")
+		}
+
+		set, err := Load(cfg.JwtKeysDir, cfg.JwtSigningKeyID)
+		if errors.Is(err, errNoKeys) && cfg.JwtEphemeralKey {
+			log.Printf("no jwt keys found in %q, using an ephemeral key", cfg.JwtKeysDir)
+			set, err = Ephemeral()
+		}
+
+		if err != nil {
+			panic(fmt.Sprintf("Unable to load jwt keys: %v", err))
+		}
+
+		defaultSet = set
+	})
+
+	return defaultSet
+}
+
+var errNoKeys = errors.New("no keys")
+
+// Load every .pem file of the directory, the kid of each key is its file name without extension.
+// The signing key is the given one or the last private key by kid, so date based names rotate naturally
+func Load(dir, signingID string) (*KeySet, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	set := &KeySet{keys: map[string]*Key{}}
+	var privateIDs []string
+
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		id := strings.TrimSuffix(filepath.Base(file), ".pem")
+		key, err := parseKey(id, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		set.keys[id] = key
+		if key.Private != nil {
+			privateIDs = append(privateIDs, id)
+		}
+	}
+
+	if len(set.keys) == 0 {
+		return nil, errNoKeys
+	}
+
+	if signingID == "" && len(privateIDs) > 0 {
+		sort.Strings(privateIDs)
+		signingID = privateIDs[len(privateIDs)-1]
+	}
+
+	signing, ok := set.keys[signingID]
+	if !ok || signing.Private == nil {
+		return nil, fmt.Errorf("signing key %q not found or has no private key", signingID)
+	}
+	set.signing = signing
+
+	return set, nil
+}
+
+// Create a set with a single random Ed25519 key
+func Ephemeral() (*KeySet, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{ID: "ephemeral", Method: SigningMethodEdDSA, Private: private, Public: public}
+	return &KeySet{keys: map[string]*Key{key.ID: key}, signing: key}, nil
+}
+
+// parse a pem encoded private or public RSA or Ed25519 key
+func parseKey(id string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid pem")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported pem block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{ID: id}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.Method, key.Private, key.Public = SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.Method, key.Public = SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	return key, nil
+}
+
+// Sign the claims with the signing key setting its kid in the header
+func (s *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(s.signing.Method, claims)
+	token.Header["kid"] = s.signing.ID
+
+	return token.SignedString(s.signing.Private)
+}
+
+// Parse and verify the token with the key named by its kid
+func (s *KeySet) Parse(strToken string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(strToken, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, ok := s.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown kid %q", kid)
+		}
+
+		if t.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %q", t.Method.Alg())
+		}
+
+		return key.Public, nil
+	})
+}
+
+// JWK definition, the public part of a key as published in the JWKS endpoint
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS definition
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Get the public keys of the set, ephemeral keys included
+func (s *KeySet) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+
+	ids := make([]string, 0, len(s.keys))
+	for id := range s.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		key := s.keys[id]
+		jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+
+		switch public := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	return jwks
+}
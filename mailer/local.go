@@ -0,0 +1,48 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileMailer write every message as a .eml file in a directory. Useful in local development
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+// Write the message in the mail directory
+func (m *FileMailer) Send(msg Message) error {
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d.eml", time.Now().UnixNano())
+	return os.WriteFile(filepath.Join(m.Dir, name), format(m.From, msg), 0o644)
+}
+
+// MemoryMailer keep the sent messages in memory. Useful in tests
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// Store the message
+func (m *MemoryMailer) Send(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Retrieve a copy of the sent messages
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Message(nil), m.messages...)
+}
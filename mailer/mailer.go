@@ -0,0 +1,38 @@
+package mailer
+
+import (
+	"contacts/config"
+	"fmt"
+)
+
+// Message definition
+type Message struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// Mailer interface, implemented by every mail sender
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// Create the mailer selected by the MAIL_DRIVER setting
+func New(cfg config.Properties) (Mailer, error) {
+	switch cfg.MailDriver {
+	case "smtp":
+		return &SMTPMailer{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.MailFrom,
+		}, nil
+	case "file":
+		return &FileMailer{Dir: cfg.MailDir, From: cfg.MailFrom}, nil
+	case "memory":
+		return &MemoryMailer{}, nil
+	}
+
+	return nil, fmt.Errorf("unknown mail driver %q", cfg.MailDriver)
+}
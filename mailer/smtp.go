@@ -0,0 +1,34 @@
+package mailer
+
+import (
+	"fmt"
+	"net/smtp"
+)
+
+// SMTPMailer send messages through an smtp server
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// Send the message to the smtp server, authenticating only if credentials are set
+func (m *SMTPMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	addr := fmt.Sprintf("%s:%s", m.Host, m.Port)
+	return smtp.SendMail(addr, auth, m.From, []string{msg.To}, format(m.From, msg))
+}
+
+// build the raw message with its headers
+func format(from string, msg Message) []byte {
+	return []byte(fmt.Sprintf(
+		"From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n",
+		from, msg.To, msg.Subject, msg.Body,
+	))
+}
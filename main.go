@@ -4,7 +4,11 @@ import (
 	"contacts/config"
 	"contacts/db"
 	"contacts/handlers"
+	"contacts/jobs"
+	"contacts/mailer"
 	"contacts/middlewares"
+	"contacts/models"
+	"context"
 	"fmt"
 
 	"github.com/ilyakaznacheev/cleanenv"
@@ -14,47 +18,214 @@ import (
 )
 
 var (
-	usersColl *mongo.Collection
-	postsColl *mongo.Collection
-	cfg       config.Properties
+	usersColl    *mongo.Collection
+	postsColl    *mongo.Collection
+	sessionsColl *mongo.Collection
+	resetsColl   *mongo.Collection
+	verifyColl   *mongo.Collection
+	tokensColl   *mongo.Collection
+	throttleColl *mongo.Collection
+	attemptsColl *mongo.Collection
+	auditColl    *mongo.Collection
+	revisionColl *mongo.Collection
+	timelineColl *mongo.Collection
+	activityColl *mongo.Collection
+	trendsColl   *mongo.Collection
+	mail         mailer.Mailer
+	cfg          config.Properties
 )
 
 // init get connection with the db and read config
 func init() {
-	usersColl, postsColl = db.GetConnection()
 	if err := cleanenv.ReadEnv(&cfg); err != nil {
 		panic("Unable to read configuration")
 	}
+	usersColl, postsColl = db.GetConnection()
+	sessionsColl = db.GetCollection(cfg.SessionsCollection, db.SessionIndexes...)
+	resetsColl = db.GetCollection(cfg.ResetsCollection, db.PasswordResetIndexes...)
+	verifyColl = db.GetCollection(cfg.VerificationsCollection, db.VerificationIndexes...)
+	tokensColl = db.GetCollection(cfg.TokensCollection, db.AccessTokenIndexes...)
+	throttleColl = db.GetCollection(cfg.ThrottlesCollection)
+	attemptsColl = db.GetCollection(cfg.AttemptsCollection, db.LoginAttemptIndexes...)
+	auditColl = db.GetCollection(cfg.AuditCollection, db.AuditIndexes...)
+	revisionColl = db.GetCollection(cfg.RevisionsCollection, db.RevisionIndexes...)
+	timelineColl = db.GetCollection(cfg.TimelinesCollection, db.TimelineIndexes...)
+	activityColl = db.GetCollection(cfg.ActivityCollection, db.ActivityIndexes...)
+	trendsColl = db.GetCollection(cfg.TrendsCollection)
+	if err := db.SyncFollowerCounts(context.Background(), usersColl); err != nil {
+		panic("Unable to count the followers of the users")
+	}
+	if err := db.SyncAuthorPrivacy(context.Background(), usersColl, postsColl, activityColl); err != nil {
+		panic("Unable to sync the privacy of the posts")
+	}
+	if err := db.SyncPublishedAt(context.Background(), postsColl, timelineColl); err != nil {
+		panic("Unable to sync the publication date of the posts")
+	}
+
+	var err error
+	if mail, err = mailer.New(cfg); err != nil {
+		panic("Unable to create mailer")
+	}
 }
 
 func main() {
 	// create new echo instance and set middlewares
 	e := echo.New()
+	ipExtractor, err := middlewares.IPExtractor()
+	if err != nil {
+		panic("Invalid TRUSTED_PROXIES")
+	}
+	e.IPExtractor = ipExtractor
 	e.Pre(middleware.RemoveTrailingSlash())
 	e.Use(middlewares.LoggerMiddleware())
-	e.Use(middlewares.JwtMiddleware())
+	e.Use(middlewares.JwtMiddleware(sessionsColl, tokensColl))
+
+	// instance handlers uh(users handler) ph(posts handlers) sh(search handler) ah(admin handler)
+	uh := &handlers.UsersHandler{
+		Col:           usersColl,
+		Posts:         postsColl,
+		Sessions:      sessionsColl,
+		Resets:        resetsColl,
+		Verifications: verifyColl,
+		Tokens:        tokensColl,
+		Throttles:     throttleColl,
+		Attempts:      attemptsColl,
+		Timelines:     timelineColl,
+		Activity:      activityColl,
+		Mailer:        mail,
+	}
+	ph := &handlers.PostsHandler{
+		Col:       postsColl,
+		Users:     usersColl,
+		Revisions: revisionColl,
+		Timelines: timelineColl,
+		Activity:  activityColl,
+		Trends:    trendsColl,
+	}
+	sh := &handlers.SearchHandler{Engine: &db.MongoSearch{Users: usersColl, Posts: postsColl}, Users: usersColl}
+	ah := &handlers.AdminHandler{Users: usersColl, Throttles: throttleColl, Attempts: attemptsColl}
 
-	// instance handlers uh(users handler) ph(posts handlers)
-	uh := &handlers.UsersHandler{Col: usersColl}
-	ph := &handlers.PostsHandler{Col: postsColl}
+	// scopes required to personal access tokens
+	postsRead := middlewares.RequireScope(models.ScopePostsRead)
+	postsWrite := middlewares.RequireScope(models.ScopePostsWrite)
+	usersRead := middlewares.RequireScope(models.ScopeUsersRead)
+	usersWrite := middlewares.RequireScope(models.ScopeUsersWrite)
 
 	// posts endpoints
-	e.POST("/posts/create", ph.CreatePost)
-	e.GET("/posts/:id", ph.GetPost)
-	e.GET("/posts", ph.ListPosts)
-	e.DELETE("/posts/:id", ph.RemovePost, middlewares.IsPostOwner)
-	e.PATCH("/posts/:id", ph.PostUpdate, middlewares.IsPostOwner)
-	e.POST("/posts/:id/comment", ph.CommentPost)
-	e.DELETE("/posts/:id/comment/:cid", ph.DeleteComment, middlewares.IsCommentOwner)
-	e.POST("/posts/:id/like", ph.ToggleLikePost)
+	e.POST("/posts/create", ph.CreatePost, postsWrite, middlewares.IsVerified(usersColl))
+	e.GET("/posts/:id", ph.GetPost, postsRead)
+	e.GET("/posts", ph.ListPosts, postsRead)
+	e.DELETE("/posts/:id", ph.RemovePost, postsWrite,
+		middlewares.Audit(auditColl, "post.delete"),
+		middlewares.IsPostOwnerOr(postsColl, models.RoleModerator, models.RoleAdmin))
+	e.PATCH("/posts/:id", ph.PostUpdate, postsWrite, middlewares.IsPostOwner(postsColl))
+	e.POST("/posts/:id/comment", ph.CommentPost, postsWrite, middlewares.IsVerified(usersColl))
+	e.DELETE("/posts/:id/comment/:cid", ph.DeleteComment, postsWrite,
+		middlewares.Audit(auditColl, "comment.delete"),
+		middlewares.IsCommentOwnerOr(postsColl, models.RoleModerator, models.RoleAdmin))
+	e.POST("/posts/:id/like", ph.ToggleLikePost, postsWrite)
+	e.POST("/posts/:id/publish", ph.PublishPost, postsWrite, middlewares.IsPostOwner(postsColl))
+	e.GET("/posts/:id/revisions", ph.ListRevisions, postsRead)
+	e.GET("/posts/:id/revisions/:rev", ph.GetRevision, postsRead)
+	e.POST("/posts/:id/revisions/:rev/restore", ph.RestoreRevision, postsWrite, middlewares.IsPostOwner(postsColl))
+	e.POST("/posts/:id/restore", ph.RestorePost, postsWrite)
+	e.POST("/posts/:id/comment/:cid/restore", ph.RestoreComment, postsWrite)
+
+	// tags endpoints
+	e.GET("/tags", ph.ListTags, postsRead)
+	e.GET("/tags/:tag/posts", ph.GetTagPosts, postsRead)
+	e.POST("/tags/:tag/follow", ph.FollowTag, usersWrite)
+
+	// search endpoint, the scope depends on what is searched
+	e.GET("/search", sh.Search)
+
+	// public endpoints, reachable without an account
+	e.GET("/explore", ph.Explore)
+	e.GET("/trending/posts", ph.TrendingPosts)
+	e.GET("/trending/tags", ph.TrendingTags)
 
 	// users endpoints
 	e.POST("/users/signup", uh.Signup)
 	e.POST("/users/login", uh.Login)
-	e.GET("/users/:id", uh.GetUser)
-	e.GET("users/:id/posts", uh.GetUserPosts)
-	e.GET("/users/:id/followers", uh.GetFollowers)
-	e.POST("/users/:id/follow", uh.FollowUser)
+	e.POST("/users/login/2fa", uh.LoginSecondFactor)
+	e.POST("/users/logout", uh.Logout, middlewares.SessionOnly)
+	e.POST("/users/token/refresh", uh.RefreshToken)
+	e.POST("/users/password/forgot", uh.ForgotPassword)
+	e.POST("/users/password/reset", uh.ResetPassword)
+	e.GET("/users/verify", uh.VerifyEmail)
+	e.POST("/users/verify/resend", uh.ResendVerification, middlewares.SessionOnly)
+	e.POST("/users/me/2fa/setup", uh.SetupTOTP, middlewares.SessionOnly)
+	e.POST("/users/me/2fa/confirm", uh.ConfirmTOTP, middlewares.SessionOnly)
+	e.GET("/users/me/sessions", uh.ListSessions, middlewares.SessionOnly)
+	e.DELETE("/users/me/sessions", uh.RevokeOtherSessions, middlewares.SessionOnly)
+	e.DELETE("/users/me/sessions/:sid", uh.RevokeSession, middlewares.SessionOnly)
+	e.POST("/users/me/tokens", uh.CreateAccessToken, middlewares.SessionOnly)
+	e.GET("/users/me/tokens", uh.ListAccessTokens, middlewares.SessionOnly)
+	e.DELETE("/users/me/tokens/:tid", uh.RevokeAccessToken, middlewares.SessionOnly)
+	e.PATCH("/users/me", uh.UpdateProfile, usersWrite)
+	e.DELETE("/users/me", uh.DeleteAccount, middlewares.SessionOnly)
+	e.POST("/users/me/password", uh.ChangePassword, middlewares.SessionOnly)
+	e.POST("/users/me/email", uh.ChangeEmail, middlewares.SessionOnly)
+	e.GET("/users/me/blocked", uh.GetBlocked, usersRead)
+	e.GET("/users/me/muted", uh.GetMuted, usersRead)
+	e.GET("/users/me/follow-requests", uh.GetFollowRequests, usersRead)
+	e.POST("/users/me/follow-requests/:id/approve", uh.ApproveFollowRequest, usersWrite)
+	e.POST("/users/me/follow-requests/:id/reject", uh.RejectFollowRequest, usersWrite)
+	e.GET("/users/me/suggestions", uh.GetSuggestions, usersRead)
+	e.POST("/users/me/suggestions/:id/dismiss", uh.DismissSuggestion, usersWrite)
+	e.GET("/users/:id", uh.GetUser, usersRead)
+	e.GET("users/:id/posts", uh.GetUserPosts, postsRead)
+	e.GET("/users/me/drafts", ph.ListDrafts, postsRead)
+	e.GET("/users/me/trash", ph.GetTrash, postsRead)
+	e.GET("/users/me/trash/comments", ph.GetTrashedComments, postsRead)
+	e.GET("/users/me/tags", ph.GetFollowedTags, usersRead)
+	e.GET("/users/:id/followers", uh.GetFollowers, usersRead)
+	e.GET("/users/:id/following", uh.GetFollowing, usersRead)
+	e.GET("/users/:id/mutuals", uh.GetMutuals, usersRead)
+	e.GET("/users/:id/relationship/:other", uh.GetRelationship, usersRead)
+	e.POST("/users/:id/follow", uh.FollowUser, usersWrite)
+	e.POST("/users/:id/block", uh.BlockUser, usersWrite)
+	e.POST("/users/:id/mute", uh.MuteUser, usersWrite)
+
+	// keys endpoints
+	e.GET("/.well-known/jwks.json", handlers.GetJWKS)
+
+	// admin endpoints
+	admin := e.Group("/admin", middlewares.RequireRole(models.RoleAdmin))
+	admin.GET("/users/:id/roles", ah.GetUserRoles, middlewares.Audit(auditColl, "user.roles.read"))
+	admin.PUT("/users/:id/roles", ah.SetUserRoles, middlewares.Audit(auditColl, "user.roles.update"))
+	admin.DELETE("/users/:id/lockout", ah.UnlockUser, middlewares.Audit(auditColl, "user.unlock"))
+	admin.DELETE("/lockouts/ips/:ip", ah.UnlockIP, middlewares.Audit(auditColl, "ip.unlock"))
+	admin.GET("/login-attempts", ah.ListLoginAttempts, middlewares.Audit(auditColl, "login_attempts.read"))
+
+	// background jobs
+	deleter := &jobs.AccountDeleter{
+		Cols: db.DeletionCollections{
+			Users:         usersColl,
+			Posts:         postsColl,
+			Sessions:      sessionsColl,
+			Resets:        resetsColl,
+			Verifications: verifyColl,
+			Tokens:        tokensColl,
+			Revisions:     revisionColl,
+			Timelines:     timelineColl,
+			Activity:      activityColl,
+		},
+		Interval: cfg.AccountDeletionInterval,
+	}
+	go deleter.Run(context.Background())
+
+	publisher := &jobs.Publisher{Posts: postsColl, Interval: cfg.PublishInterval}
+	go publisher.Run(context.Background())
+
+	purger := &jobs.Purger{Posts: postsColl, Revisions: revisionColl, Interval: cfg.PurgeInterval}
+	go purger.Run(context.Background())
+
+	fanout := &jobs.FanOut{Users: usersColl, Posts: postsColl, Timelines: timelineColl, Interval: cfg.FanoutInterval}
+	go fanout.Run(context.Background())
+
+	trending := &jobs.TrendingAggregator{Activity: activityColl, Trends: trendsColl, Interval: cfg.TrendingInterval}
+	go trending.Run(context.Background())
 
 	// initializer server
 	e.Logger.Info("Listening on port %s:%s", cfg.Host, cfg.Port)
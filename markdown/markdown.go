@@ -0,0 +1,27 @@
+package markdown
+
+import (
+	"bytes"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// markdown flavour of the posts: commonmark with tables, strikethrough, autolinks and task lists.
+// Raw HTML in the source is never rendered
+var renderer = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+// allowed elements and attributes of the rendered html. Scripts, styles, event handlers
+// and javascript urls are removed and links are marked as nofollow
+var policy = bluemonday.UGCPolicy()
+
+// Render the markdown source to html that is safe to embed in a page
+func Render(source string) (string, error) {
+	var buf bytes.Buffer
+	if err := renderer.Convert([]byte(source), &buf); err != nil {
+		return "", err
+	}
+
+	return policy.Sanitize(buf.String()), nil
+}
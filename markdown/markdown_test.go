@@ -0,0 +1,60 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderRemovesUnsafeHTML(t *testing.T) {
+	cases := []struct {
+		name   string
+		source string
+		unsafe []string
+	}{
+		{"script", "hello <script>alert(1)</script>", []string{"<script"}},
+		{"script block", "<script>\nalert(1)\n</script>", []string{"<script"}},
+		{"event handler", `<img src="x.png" onerror="alert(1)">`, []string{"onerror", "alert(1)"}},
+		{"inline event handler", `text <b onclick="alert(1)">bold</b>`, []string{"onclick", "alert(1)"}},
+		{"javascript link", "[x](javascript:alert(1))", []string{"javascript:", "alert(1)"}},
+		{"javascript link case", "[x](JavaScript:alert(1))", []string{"javascript:", "alert(1)"}},
+		{"javascript autolink", "<javascript:alert(1)>", []string{"href=\"javascript:"}},
+		{"javascript image", "![x](javascript:alert(1))", []string{"javascript:", "alert(1)"}},
+	}
+
+	for _, c := range cases {
+		html, err := Render(c.source)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+
+		for _, unsafe := range c.unsafe {
+			if strings.Contains(strings.ToLower(html), strings.ToLower(unsafe)) {
+				t.Errorf("%s: %q survives in %q", c.name, unsafe, html)
+			}
+		}
+	}
+}
+
+func TestRenderKeepsMarkdown(t *testing.T) {
+	cases := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"emphasis", "some *text*", "<em>text</em>"},
+		{"link", "[site](https://example.com)", `href="https://example.com"`},
+		{"nofollow", "[site](https://example.com)", `rel="nofollow"`},
+		{"strikethrough", "~~gone~~", "<del>gone</del>"},
+	}
+
+	for _, c := range cases {
+		html, err := Render(c.source)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+
+		if !strings.Contains(html, c.want) {
+			t.Errorf("%s: got %q, want it to contain %q", c.name, html, c.want)
+		}
+	}
+}
@@ -3,8 +3,11 @@ package middlewares
 import (
 	"contacts/config"
 	"contacts/db"
+	"contacts/keys"
 	"contacts/models"
 	"context"
+	"errors"
+	"net"
 	"strings"
 
 	"github.com/dgrijalva/jwt-go"
@@ -17,6 +20,9 @@ import (
 
 var cfg config.Properties
 
+// context key set when a role granted access to the requested resource
+const privilegedKey = "privileged"
+
 // init read configuration settings
 func init() {
 	if err := cleanenv.ReadEnv(&cfg); err != nil {
@@ -35,99 +41,339 @@ func LoggerMiddleware() echo.MiddlewareFunc {
 	return logger
 }
 
-// check for tokens in all enpoints except the defines in the Skipper
-func JwtMiddleware() echo.MiddlewareFunc {
-	jwtMidd := middleware.JWTWithConfig(middleware.JWTConfig{
-		SigningKey:  []byte(cfg.JwtTokenSecret),
-		TokenLookup: "header:x-auth-token",
-		Skipper: func(c echo.Context) bool {
-			if c.Path() == "/users/login" || c.Path() == "/users/signup" {
-				return true
+// Extract the ip of the client from the connection. Behind proxies listed in TRUSTED_PROXIES
+// the X-Forwarded-For header is read, skipping the addresses of those proxies
+func IPExtractor() (echo.IPExtractor, error) {
+	if len(cfg.TrustedProxies) == 0 {
+		return echo.ExtractIPDirect(), nil
+	}
+
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, proxy := range cfg.TrustedProxies {
+		_, ipRange, err := net.ParseCIDR(strings.TrimSpace(proxy))
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, echo.TrustIPRange(ipRange))
+	}
+
+	return echo.ExtractIPFromXFFHeader(options...), nil
+}
+
+// endpoints that can be reached without an access token
+var publicPaths = map[string]bool{
+	"/users/login":           true,
+	"/users/login/2fa":       true,
+	"/users/signup":          true,
+	"/users/token/refresh":   true,
+	"/users/password/forgot": true,
+	"/users/password/reset":  true,
+	"/users/verify":          true,
+	"/.well-known/jwks.json": true,
+	"/explore":               true,
+	"/trending/posts":        true,
+	"/trending/tags":         true,
+}
+
+// check for tokens in all enpoints except the public ones and reject tokens whose
+// session was revoked. Personal access tokens are accepted too, their scopes are
+// checked by RequireScope in every route
+func JwtMiddleware(sessions, tokens db.CollectionAPI) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if publicPaths[c.Path()] {
+				return next(c)
 			}
-			return false
-		},
-	})
 
-	return jwtMidd
+			headerToken := c.Request().Header.Get("x-auth-token")
+			if !strings.HasPrefix(headerToken, "Bearer ") {
+				return echo.NewHTTPError(400, "missing or malformed jwt")
+			}
+			strToken := strings.TrimPrefix(headerToken, "Bearer ")
+
+			if strings.HasPrefix(strToken, models.AccessTokenPrefix) {
+				accessToken, httpErr := db.UseAccessToken(context.Background(), strToken, tokens)
+				if httpErr != nil {
+					return httpErr
+				}
+
+				scopes := make([]interface{}, len(accessToken.Scopes))
+				for i, scope := range accessToken.Scopes {
+					scopes[i] = scope
+				}
+
+				c.Set("user", &jwt.Token{
+					Valid: true,
+					Claims: jwt.MapClaims{
+						"user_id": accessToken.UserID,
+						"tid":     accessToken.ID.Hex(),
+						"scopes":  scopes,
+					},
+				})
+
+				return next(c)
+			}
+
+			token, claims, err := ParseToken(strToken)
+			if err != nil {
+				return echo.NewHTTPError(401, "invalid or expired jwt")
+			}
+
+			sessionID, _ := claims["sid"].(string)
+			if !db.IsSessionActive(context.Background(), sessionID, sessions) {
+				return echo.NewHTTPError(401, "Session expired or revoked")
+			}
+
+			c.Set("user", token)
+			return next(c)
+		}
+	}
 }
 
-// Check if requesting user is owner of the post
-func IsPostOwner(next echo.HandlerFunc) echo.HandlerFunc {
-	return func(c echo.Context) error {
-		var post models.Post
+// Check if a personal access token was granted the scope required by the route.
+// Tokens of a login session are not limited by scopes
+func RequireScope(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !HasScope(c, scope) {
+				return echo.NewHTTPError(403, "Token is missing the "+scope+" scope")
+			}
 
-		id, err := primitive.ObjectIDFromHex(c.Param("id"))
-		if err != nil {
-			echo.NewHTTPError(500, "Unable to convert to object id")
+			return next(c)
 		}
+	}
+}
 
-		_, postColl := db.GetConnection()
-		defer postColl.Database().Client().Disconnect(context.Background())
+// Check if the token of the request was granted the scope, for routes whose scope
+// depends on the request. Tokens of a login session have every scope
+func HasScope(c echo.Context, scope string) bool {
+	_, claims := GetToken(c)
+	granted, isAccessToken := claims["scopes"].([]interface{})
+	if !isAccessToken {
+		return true
+	}
 
-		result := postColl.FindOne(context.Background(), bson.M{"_id": id})
-		if err := result.Decode(&post); err != nil {
-			return echo.NewHTTPError(500, "Unable to decode retrieved user")
+	for _, g := range granted {
+		if g == scope {
+			return true
 		}
+	}
 
-		_, claims := GetToken(c)
+	return false
+}
 
-		if claims["user_id"] != post.From {
-			return echo.NewHTTPError(403, "You dont have permissions to perform this action")
+// Reject personal access tokens, the route can only be used from a login session
+func SessionOnly(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		_, claims := GetToken(c)
+		if _, isAccessToken := claims["scopes"]; isAccessToken {
+			return echo.NewHTTPError(403, "Personal access tokens can not perform this action")
 		}
 
 		return next(c)
 	}
+}
+
+// Check if requesting user is owner of the post
+func IsPostOwner(posts db.CollectionAPI) echo.MiddlewareFunc {
+	return IsPostOwnerOr(posts)
+}
+
+// Check if requesting user is owner of the post or has one of the given roles
+func IsPostOwnerOr(posts db.CollectionAPI, roles ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			// trashed posts can only be restored
+			post, httpErr := db.FindPost(context.Background(), c.Param("id"), posts)
+			if httpErr != nil {
+				return httpErr
+			}
+
+			_, claims := GetToken(c)
+
+			if claims["user_id"] != post.From {
+				if !hasRole(claims, roles...) {
+					return echo.NewHTTPError(403, "You dont have permissions to perform this action")
+				}
+				c.Set(privilegedKey, true)
+			}
 
+			return next(c)
+		}
+	}
 }
 
 // Check if requesting user is owner of the comment
-func IsCommentOwner(next echo.HandlerFunc) echo.HandlerFunc {
-	return func(c echo.Context) error {
-		var post models.Post
+func IsCommentOwner(posts db.CollectionAPI) echo.MiddlewareFunc {
+	return IsCommentOwnerOr(posts)
+}
 
-		postID, err := primitive.ObjectIDFromHex(c.Param("id"))
-		if err != nil {
-			return echo.NewHTTPError(500, "Unable to convert to object id")
+// Check if requesting user is owner of the comment or has one of the given roles
+func IsCommentOwnerOr(posts db.CollectionAPI, roles ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			var post models.Post
+
+			postID, err := primitive.ObjectIDFromHex(c.Param("id"))
+			if err != nil {
+				return echo.NewHTTPError(500, "Unable to convert to object id")
+			}
+
+			commentID, err := primitive.ObjectIDFromHex(c.Param("cid"))
+			if err != nil {
+				return echo.NewHTTPError(500, "Unable to convert to object id")
+			}
+			result := posts.FindOne(context.Background(), bson.M{"_id": postID})
+			if err = result.Decode(&post); err != nil {
+				return echo.NewHTTPError(422, "Unable to parse retrieved post")
+			}
+
+			_, claims := GetToken(c)
+
+			for _, comment := range post.Comments {
+				if comment.ID == commentID {
+					if comment.From != claims["user_id"] {
+						if !hasRole(claims, roles...) {
+							return echo.NewHTTPError(403, "You do not have permissions to perform this action")
+						}
+						c.Set(privilegedKey, true)
+					}
+				}
+			}
+			return next(c)
 		}
+	}
+}
 
-		commentID, err := primitive.ObjectIDFromHex(c.Param("cid"))
-		if err != nil {
-			return echo.NewHTTPError(500, "Unable to convert to object id")
+// Check if requesting user has at least one of the given roles
+func RequireRole(roles ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			_, claims := GetToken(c)
+			if !hasRole(claims, roles...) {
+				return echo.NewHTTPError(403, "You dont have permissions to perform this action")
+			}
+
+			c.Set(privilegedKey, true)
+			return next(c)
 		}
-		ctx := context.Background()
-		_, postColl := db.GetConnection()
-		defer postColl.Database().Client().Disconnect(ctx)
+	}
+}
 
-		result := postColl.FindOne(ctx, bson.M{"_id": postID})
-		if err = result.Decode(&post); err != nil {
-			return echo.NewHTTPError(422, "Unable to parse retrieved post")
+// Record the privileged actions performed through the route with the acting user.
+// An action is privileged when a role, and not the ownership, granted the access
+func Audit(audit db.CollectionAPI, action string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			err := next(c)
+			if privileged, _ := c.Get(privilegedKey).(bool); !privileged {
+				return err
+			}
+
+			status := c.Response().Status
+			if httpErr, ok := err.(*echo.HTTPError); ok {
+				status = httpErr.Code
+			}
+
+			_, claims := GetToken(c)
+			actorID, _ := claims["user_id"].(string)
+			entry := models.AuditEntry{
+				ActorID: actorID,
+				Action:  action,
+				Method:  c.Request().Method,
+				Path:    c.Request().URL.Path,
+				Status:  status,
+			}
+
+			if httpErr := db.RecordAudit(context.Background(), entry, audit); httpErr != nil {
+				c.Logger().Errorf("unable to record audit entry: %v", httpErr.Message)
+			}
+
+			return err
 		}
+	}
+}
 
-		_, claims := GetToken(c)
+// check if the claims contain one of the given roles
+func hasRole(claims jwt.MapClaims, roles ...string) bool {
+	granted, _ := claims["roles"].([]interface{})
+	for _, role := range roles {
+		for _, g := range granted {
+			if g == role {
+				return true
+			}
+		}
+	}
 
-		for _, comment := range post.Comments {
-			if comment.ID == commentID {
-				if comment.From != claims["user_id"] {
-					return echo.NewHTTPError(403, "You do not have permissions to perform this action")
-				}
+	return false
+}
+
+// Check if requesting user verified the email. Only enforced when REQUIRE_VERIFIED_EMAIL is set
+func IsVerified(users db.CollectionAPI) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !cfg.RequireVerifiedEmail {
+				return next(c)
+			}
+
+			_, claims := GetToken(c)
+			userID, _ := claims["user_id"].(string)
+
+			user, httpErr := db.FindUser(context.Background(), userID, users)
+			if httpErr != nil {
+				return httpErr
+			}
+
+			if !user.Verified {
+				return echo.NewHTTPError(403, "You need to verify your email to perform this action")
 			}
+
+			return next(c)
 		}
-		return next(c)
 	}
 }
 
-// Get token from headers
+// Get token from the context once authenticated, or from headers
 func GetToken(c echo.Context) (*jwt.Token, jwt.MapClaims) {
+	if token, ok := c.Get("user").(*jwt.Token); ok {
+		if claims, ok := token.Claims.(jwt.MapClaims); ok {
+			return token, claims
+		}
+	}
+
 	headerToken := c.Request().Header.Get("x-auth-token")
 	strToken := strings.Split(headerToken, " ")[1]
-	claims := jwt.MapClaims{}
 
-	token, err := jwt.ParseWithClaims(strToken, claims, func(t *jwt.Token) (interface{}, error) {
-		return []byte(cfg.JwtTokenSecret), nil
-	})
+	token, claims, err := ParseToken(strToken)
 	if err != nil {
 		return nil, nil
 	}
 
 	return token, claims
 }
+
+// Parse and validate an access token signed by the app
+func ParseToken(strToken string) (*jwt.Token, jwt.MapClaims, error) {
+	return parseToken(strToken, models.AccessTokenType, models.AccessAudience)
+}
+
+// Parse and validate the challenge token of a two-step login
+func ParseChallengeToken(strToken string) (*jwt.Token, jwt.MapClaims, error) {
+	return parseToken(strToken, models.ChallengeTokenType, models.ChallengeAudience)
+}
+
+// parse a token signed by the app and check it has the given type and audience
+func parseToken(strToken, typ, audience string) (*jwt.Token, jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+
+	token, err := keys.Default().Parse(strToken, claims)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if claims["typ"] != typ || !claims.VerifyAudience(audience, true) {
+		return nil, nil, errors.New("unexpected token type or audience")
+	}
+
+	return token, claims, nil
+}
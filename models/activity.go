@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// kinds of the activity on the posts
+const (
+	ActivityLike    = "like"
+	ActivityComment = "comment"
+)
+
+// Activity definition. A like or comment of a user on a post, kept for the trending windows
+type Activity struct {
+	ID        primitive.ObjectID  `json:"_id" bson:"_id"`
+	Kind      string              `json:"kind" bson:"kind"`
+	UserID    string              `json:"user_id" bson:"user_id"`
+	PostID    string              `json:"post_id" bson:"post_id"`
+	AuthorID  string              `json:"author_id" bson:"author_id"`
+	Private   bool                `json:"-" bson:"author_private,omitempty"`
+	CommentID *primitive.ObjectID `json:"comment_id,omitempty" bson:"comment_id,omitempty"`
+	Tags      []string            `json:"tags,omitempty" bson:"tags,omitempty"`
+	CreatedAt time.Time           `json:"created_at" bson:"created_at"`
+}
+
+// Create the activity of the user on the post
+func NewActivity(kind, userID string, post Post, createdAt time.Time) Activity {
+	return Activity{
+		ID:        primitive.NewObjectID(),
+		Kind:      kind,
+		UserID:    userID,
+		PostID:    post.ID.Hex(),
+		AuthorID:  post.From,
+		Private:   post.AuthorPrivate,
+		Tags:      post.Tags,
+		CreatedAt: createdAt,
+	}
+}
+
+// Trend definition. The likes and comments a post or a tag got within a window
+type Trend struct {
+	Key      string  `json:"-" bson:"key"`
+	Likes    int     `json:"likes" bson:"likes"`
+	Comments int     `json:"comments" bson:"comments"`
+	Score    float64 `json:"score" bson:"score"`
+}
+
+// Trends definition. The trending posts or tags of a window computed by the aggregator
+type Trends struct {
+	ID         string    `json:"-" bson:"_id"`
+	Items      []Trend   `json:"items" bson:"items"`
+	ComputedAt time.Time `json:"computed_at" bson:"computed_at"`
+}
+
+// TrendingPost definition. A trending post with its activity
+type TrendingPost struct {
+	Post Post `json:"post"`
+	Trend
+}
+
+// TrendingTag definition. A trending tag with its activity
+type TrendingTag struct {
+	Tag string `json:"tag"`
+	Trend
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AuditEntry definition. Records a privileged action and the user who performed it
+type AuditEntry struct {
+	ID        primitive.ObjectID `json:"_id,omitempty" bson:"_id"`
+	ActorID   string             `json:"actor_id" bson:"actor_id"`
+	Action    string             `json:"action" bson:"action"`
+	Method    string             `json:"method" bson:"method"`
+	Path      string             `json:"path" bson:"path"`
+	Status    int                `json:"status" bson:"status"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
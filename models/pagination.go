@@ -0,0 +1,19 @@
+package models
+
+// pagination defaults and bounds enforced by the server
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+// PageQuery definition. The size of the page and the opaque cursor returned by the previous page
+type PageQuery struct {
+	Limit  int
+	Cursor string
+}
+
+// Page definition. Envelope of every list response, next_cursor is empty on the last page
+type Page struct {
+	Data       interface{} `json:"data"`
+	NextCursor string      `json:"next_cursor"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PasswordReset definition. Only the hash of the token sent by mail is stored
+type PasswordReset struct {
+	ID        primitive.ObjectID `json:"_id,omitempty" bson:"_id"`
+	UserID    string             `json:"user_id" bson:"user_id"`
+	TokenHash string             `json:"-" bson:"token_hash"`
+	Used      bool               `json:"used" bson:"used"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	ExpiresAt time.Time          `json:"expires_at" bson:"expires_at"`
+}
+
+// Forgot password request payload
+type ForgotPassword struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// Reset password request payload
+type ResetPassword struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=8,max=300"`
+}
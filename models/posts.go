@@ -1,22 +1,68 @@
 package models
 
 import (
+	"time"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-// Post definition
+// publication status of the posts. Posts stored before the status existed are published
+const (
+	PostDraft     = "draft"
+	PostScheduled = "scheduled"
+	PostPublished = "published"
+)
+
+// limits of the tags of a post
+const (
+	MaxTags      = 10
+	MaxTagLength = 30
+)
+
+// Post definition. Status updates only have a short message, articles have a title and
+// a markdown body rendered to sanitized html by the server
 type Post struct {
-	ID       primitive.ObjectID `json:"_id,omitempty" bson:"_id"`
-	From     string             `json:"from" bson:"from"`
-	Message  string             `json:"message" bson:"message" validate:"required,max=255"`
-	Likes    int                `json:"likes,omitempty" bson:"likes,omitempty"`
-	LikedBy  []string           `json:"liked_by,omitempty" bson:"liked_by,omitempty"`
-	Comments []Comment          `json:"comments" bson:"comments"`
+	ID              primitive.ObjectID `json:"_id,omitempty" bson:"_id"`
+	From            string             `json:"from" bson:"from"`
+	Message         string             `json:"message,omitempty" bson:"message,omitempty" validate:"required_without=Body,max=255"`
+	Title           string             `json:"title,omitempty" bson:"title,omitempty" validate:"required_with=Body,max=200"`
+	Body            string             `json:"body,omitempty" bson:"body,omitempty" validate:"max=100000"`
+	Excerpt         string             `json:"excerpt,omitempty" bson:"excerpt,omitempty" validate:"max=500"`
+	Tags            []string           `json:"tags,omitempty" bson:"tags,omitempty" validate:"max=10,dive,max=30"`
+	HTML            string             `json:"html,omitempty" bson:"html,omitempty"`
+	Status          string             `json:"status,omitempty" bson:"status,omitempty" validate:"omitempty,oneof=draft scheduled published"`
+	PublishAt       *time.Time         `json:"publish_at,omitempty" bson:"publish_at,omitempty"`
+	PublishedAt     *time.Time         `json:"published_at,omitempty" bson:"published_at,omitempty"`
+	EditedAt        *time.Time         `json:"edited_at,omitempty" bson:"edited_at,omitempty"`
+	Revisions       int                `json:"revisions,omitempty" bson:"revisions,omitempty"`
+	DeletedAt       *time.Time         `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	DeletedBy       string             `json:"deleted_by,omitempty" bson:"deleted_by,omitempty"`
+	Likes           int                `json:"likes,omitempty" bson:"likes,omitempty"`
+	LikedBy         []string           `json:"liked_by,omitempty" bson:"liked_by,omitempty"`
+	Comments        []Comment          `json:"comments" bson:"comments"`
+	DeletedComments []Comment          `json:"-" bson:"deleted_comments,omitempty"`
+	AuthorPrivate   bool               `json:"-" bson:"author_private,omitempty"`
+	FanoutPending   bool               `json:"-" bson:"fanout_pending,omitempty"`
+	FanoutLock      *time.Time         `json:"-" bson:"fanout_lock,omitempty"`
 }
 
-// Comment definition
+// Comment definition. Deleted comments are moved out of the comments of the post until purged
 type Comment struct {
-	ID      primitive.ObjectID `json:"id,omitempty" bson:"_id"`
-	From    string             `json:"from" bson:"from"`
-	Content string             `json:"content" bson:"content" validate:"required,max=150"`
+	ID        primitive.ObjectID `json:"id,omitempty" bson:"_id"`
+	From      string             `json:"from" bson:"from"`
+	Content   string             `json:"content" bson:"content" validate:"required,max=150"`
+	DeletedAt *time.Time         `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	DeletedBy string             `json:"deleted_by,omitempty" bson:"deleted_by,omitempty"`
+}
+
+// TrashedComment definition. A deleted comment with the post it belongs to
+type TrashedComment struct {
+	PostID  string  `json:"post_id"`
+	Comment Comment `json:"comment"`
+}
+
+// TagCount definition. How many posts use the tag
+type TagCount struct {
+	Tag   string `json:"tag" bson:"_id"`
+	Count int    `json:"count" bson:"count"`
 }
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Revision definition. The content a post had before an edit
+type Revision struct {
+	ID        primitive.ObjectID `json:"_id" bson:"_id"`
+	PostID    string             `json:"post_id" bson:"post_id"`
+	Number    int                `json:"number" bson:"number"`
+	AuthorID  string             `json:"author_id" bson:"author_id"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	Message   string             `json:"message,omitempty" bson:"message,omitempty"`
+	Title     string             `json:"title,omitempty" bson:"title,omitempty"`
+	Body      string             `json:"body,omitempty" bson:"body,omitempty"`
+	Excerpt   string             `json:"excerpt,omitempty" bson:"excerpt,omitempty"`
+}
+
+// RevisionDiff definition. The revision with the line diff of every field changed since then
+type RevisionDiff struct {
+	Revision Revision          `json:"revision"`
+	Diff     map[string]string `json:"diff"`
+}
+
+// Create the revision keeping the current content of the post, edited by the author
+func NewRevision(post Post, number int, authorID string, createdAt time.Time) Revision {
+	return Revision{
+		ID:        primitive.NewObjectID(),
+		PostID:    post.ID.Hex(),
+		Number:    number,
+		AuthorID:  authorID,
+		CreatedAt: createdAt,
+		Message:   post.Message,
+		Title:     post.Title,
+		Body:      post.Body,
+		Excerpt:   post.Excerpt,
+	}
+}
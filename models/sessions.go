@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Session definition. Every login opens a session that groups all the refresh tokens
+// rotated from it, so revoking the session revokes the whole token family
+type Session struct {
+	ID          primitive.ObjectID `json:"_id,omitempty" bson:"_id"`
+	UserID      string             `json:"user_id" bson:"user_id"`
+	RefreshHash string             `json:"-" bson:"refresh_hash"`
+	UsedHashes  []string           `json:"-" bson:"used_hashes,omitempty"`
+	Revoked     bool               `json:"revoked" bson:"revoked"`
+	UserAgent   string             `json:"user_agent" bson:"user_agent"`
+	IP          string             `json:"ip" bson:"ip"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+	LastSeenAt  time.Time          `json:"last_seen_at" bson:"last_seen_at"`
+	ExpiresAt   time.Time          `json:"expires_at" bson:"expires_at"`
+	Current     bool               `json:"current" bson:"-"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// kinds of login throttles
+const (
+	ThrottleUser      = "user"
+	ThrottleIP        = "ip"
+	ThrottleTwoFactor = "2fa"
+)
+
+// Get the key of the throttle of the given kind and value, like user:john
+func ThrottleKey(kind, value string) string {
+	return kind + ":" + value
+}
+
+// LoginThrottle definition. Counts the consecutive failed logins of an account or an ip
+type LoginThrottle struct {
+	Key          string    `json:"key" bson:"_id"`
+	Failures     int       `json:"failures" bson:"failures"`
+	BlockedUntil time.Time `json:"blocked_until" bson:"blocked_until"`
+	UpdatedAt    time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// LoginAttempt definition. Every login attempt is recorded to look for attack patterns
+type LoginAttempt struct {
+	ID        primitive.ObjectID `json:"_id,omitempty" bson:"_id"`
+	Username  string             `json:"username" bson:"username"`
+	IP        string             `json:"ip" bson:"ip"`
+	UserAgent string             `json:"user_agent" bson:"user_agent"`
+	Step      string             `json:"step" bson:"step"`
+	Success   bool               `json:"success" bson:"success"`
+	Blocked   bool               `json:"blocked" bson:"blocked"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	ExpiresAt time.Time          `json:"-" bson:"expires_at"`
+}
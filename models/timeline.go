@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TimelineEntry definition. A post delivered to the home timeline of a user, the timeline
+// is sorted by publication date then post id so it keeps the order the posts were published
+type TimelineEntry struct {
+	ID          primitive.ObjectID `json:"_id" bson:"_id"`
+	UserID      string             `json:"user_id" bson:"user_id"`
+	PostID      primitive.ObjectID `json:"post_id" bson:"post_id"`
+	AuthorID    string             `json:"author_id" bson:"author_id"`
+	PublishedAt time.Time          `json:"published_at" bson:"published_at"`
+}
+
+// Create the entry delivering the published post to the timeline of the user
+func NewTimelineEntry(userID string, post Post) TimelineEntry {
+	entry := TimelineEntry{ID: primitive.NewObjectID(), UserID: userID, PostID: post.ID, AuthorID: post.From}
+	if post.PublishedAt != nil {
+		entry.PublishedAt = *post.PublishedAt
+	}
+
+	return entry
+}
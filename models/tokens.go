@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// prefix of the personal access tokens, tells them apart from JWTs
+const AccessTokenPrefix = "bpat_"
+
+// scopes that can be granted to personal access tokens
+const (
+	ScopePostsRead  = "posts:read"
+	ScopePostsWrite = "posts:write"
+	ScopeUsersRead  = "users:read"
+	ScopeUsersWrite = "users:write"
+)
+
+// AccessToken definition. A personal access token for scripts, only the hash of the token is stored
+type AccessToken struct {
+	ID         primitive.ObjectID `json:"_id,omitempty" bson:"_id"`
+	UserID     string             `json:"user_id" bson:"user_id"`
+	Name       string             `json:"name" bson:"name"`
+	Scopes     []string           `json:"scopes" bson:"scopes"`
+	TokenHash  string             `json:"-" bson:"token_hash"`
+	Revoked    bool               `json:"revoked" bson:"revoked"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+	LastUsedAt *time.Time         `json:"last_used_at,omitempty" bson:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time         `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+}
+
+// Access token creation request payload
+type NewAccessToken struct {
+	Name          string   `json:"name" validate:"required,max=100"`
+	Scopes        []string `json:"scopes" validate:"required,min=1,dive,oneof=posts:read posts:write users:read users:write"`
+	ExpiresInDays int      `json:"expires_in_days" validate:"min=0,max=365"`
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"contacts/config"
+	"contacts/keys"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
@@ -12,31 +13,198 @@ import (
 
 var cfg config.Properties
 
+// type and audience claims of the tokens signed by the app. Every kind of token is only
+// accepted where its audience is expected
+const (
+	AccessTokenType    = "access"
+	AccessAudience     = "api"
+	ChallengeTokenType = "2fa_challenge"
+	ChallengeAudience  = "login"
+)
+
+// user roles
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
 // User definition
 type User struct {
-	ID        primitive.ObjectID `json:"_id,omitempty" bson:"_id"`
-	Username  string             `json:"username" bson:"username" validate:"required,min=3"`
-	Email     string             `json:"email" bson:"email" validate:"required,email"`
-	Password  string             `json:"password" bson:"password" validate:"required,min=8,max=300"`
-	Followers []string           `json:"Followers,omitempty" bson:"followers,omitempty"`
-	Following []string           `json:"following,omitempty" bson:"following,omitempty"`
+	ID               primitive.ObjectID `json:"_id,omitempty" bson:"_id"`
+	Username         string             `json:"username" bson:"username" validate:"required,min=3"`
+	Email            string             `json:"email" bson:"email" validate:"required,email"`
+	Password         string             `json:"password" bson:"password" validate:"required,min=8,max=300"`
+	Verified         bool               `json:"verified" bson:"verified"`
+	PendingEmail     string             `json:"-" bson:"pending_email,omitempty"`
+	DisplayName      string             `json:"display_name,omitempty" bson:"display_name,omitempty"`
+	Bio              string             `json:"bio,omitempty" bson:"bio,omitempty"`
+	AvatarURL        string             `json:"avatar_url,omitempty" bson:"avatar_url,omitempty"`
+	Website          string             `json:"website,omitempty" bson:"website,omitempty"`
+	Location         string             `json:"location,omitempty" bson:"location,omitempty"`
+	Private          bool               `json:"private" bson:"private"`
+	Roles            []string           `json:"roles,omitempty" bson:"roles,omitempty"`
+	TOTPEnabled      bool               `json:"totp_enabled" bson:"totp_enabled"`
+	TOTPSecret       string             `json:"-" bson:"totp_secret,omitempty"`
+	TOTPPending      string             `json:"-" bson:"totp_pending,omitempty"`
+	TOTPLastStep     int64              `json:"-" bson:"totp_last_step,omitempty"`
+	RecoveryCodes    []string           `json:"-" bson:"recovery_codes,omitempty"`
+	DeletionDueAt    *time.Time         `json:"deletion_due_at,omitempty" bson:"deletion_due_at,omitempty"`
+	DeletionStep     int                `json:"-" bson:"deletion_step,omitempty"`
+	DeletionLock     *time.Time         `json:"-" bson:"deletion_lock,omitempty"`
+	Followers        []string           `json:"Followers,omitempty" bson:"followers,omitempty"`
+	FollowersCount   int                `json:"-" bson:"followers_count"`
+	Following        []string           `json:"following,omitempty" bson:"following,omitempty"`
+	Blocked          []string           `json:"-" bson:"blocked,omitempty"`
+	Muted            []string           `json:"-" bson:"muted,omitempty"`
+	FollowRequests   []string           `json:"-" bson:"follow_requests,omitempty"`
+	Dismissed        []string           `json:"-" bson:"dismissed_suggestions,omitempty"`
+	FollowedTags     []string           `json:"-" bson:"followed_tags,omitempty"`
+	TimelineReady    bool               `json:"-" bson:"timeline_ready,omitempty"`
+	TimelineRebuild  bool               `json:"-" bson:"timeline_rebuild,omitempty"`
+	TimelineBackfill []string           `json:"-" bson:"timeline_backfill,omitempty"`
+	TimelineLock     *time.Time         `json:"-" bson:"timeline_lock,omitempty"`
 }
 
-// util function to generate token for requesting user
-func (u User) GenerateToken() (string, *echo.HTTPError) {
+// util function to generate a short lived access token for requesting user bound to the given session
+func (u User) GenerateToken(sessionID string) (string, *echo.HTTPError) {
 	if err := cleanenv.ReadEnv(&cfg); err != nil {
 		panic("Cannot read configuration")
 	}
 
 	claims := jwt.MapClaims{}
 	claims["user_id"] = u.ID
-	claims["exp"] = time.Now().Add(time.Hour * 72).Unix()
-	at := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	claims["sid"] = sessionID
+	claims["typ"] = AccessTokenType
+	claims["aud"] = AccessAudience
+	claims["roles"] = u.GetRoles()
+	claims["exp"] = time.Now().Add(cfg.AccessTokenTTL).Unix()
+	token, err := keys.Default().Sign(claims)
+	if err != nil {
+		return "", echo.NewHTTPError(500, "Unable to create token")
+	}
+
+	return token, nil
+}
+
+// util function to generate the token that proves the password step of a two-step login was passed.
+// Its type and audience are not the ones of access tokens so it is rejected as one
+func (u User) GenerateChallengeToken() (string, *echo.HTTPError) {
+	if err := cleanenv.ReadEnv(&cfg); err != nil {
+		panic("Cannot read configuration")
+	}
 
-	token, err := at.SignedString([]byte(cfg.JwtTokenSecret))
+	claims := jwt.MapClaims{}
+	claims["user_id"] = u.ID
+	claims["typ"] = ChallengeTokenType
+	claims["aud"] = ChallengeAudience
+	claims["exp"] = time.Now().Add(cfg.ChallengeTokenTTL).Unix()
+	token, err := keys.Default().Sign(claims)
 	if err != nil {
 		return "", echo.NewHTTPError(500, "Unable to create token")
 	}
 
 	return token, nil
 }
+
+// Get the roles of the user. Users created before roles existed are plain users
+func (u User) GetRoles() []string {
+	if len(u.Roles) == 0 {
+		return []string{RoleUser}
+	}
+
+	return u.Roles
+}
+
+// Public profile of the user, safe to show to anyone
+func (u User) PublicProfile() PublicProfile {
+	return PublicProfile{
+		ID:             u.ID,
+		Username:       u.Username,
+		DisplayName:    u.DisplayName,
+		Bio:            u.Bio,
+		AvatarURL:      u.AvatarURL,
+		Website:        u.Website,
+		Location:       u.Location,
+		Private:        u.Private,
+		FollowersCount: len(u.Followers),
+		FollowingCount: len(u.Following),
+	}
+}
+
+// PublicProfile definition. The projection of the user returned to other users
+type PublicProfile struct {
+	ID             primitive.ObjectID `json:"_id"`
+	Username       string             `json:"username"`
+	DisplayName    string             `json:"display_name,omitempty"`
+	Bio            string             `json:"bio,omitempty"`
+	AvatarURL      string             `json:"avatar_url,omitempty"`
+	Website        string             `json:"website,omitempty"`
+	Location       string             `json:"location,omitempty"`
+	Private        bool               `json:"private"`
+	FollowersCount int                `json:"followers_count"`
+	FollowingCount int                `json:"following_count"`
+	PostsCount     int64              `json:"posts_count"`
+}
+
+// Profile update request payload. Only the given fields are updated, empty strings clear them
+type ProfileUpdate struct {
+	DisplayName *string `json:"display_name" bson:"display_name,omitempty" validate:"omitempty,max=50"`
+	Bio         *string `json:"bio" bson:"bio,omitempty" validate:"omitempty,max=160"`
+	AvatarURL   *string `json:"avatar_url" bson:"avatar_url,omitempty" validate:"omitempty,eq=|http_url,max=300"`
+	Website     *string `json:"website" bson:"website,omitempty" validate:"omitempty,eq=|http_url,max=300"`
+	Location    *string `json:"location" bson:"location,omitempty" validate:"omitempty,max=60"`
+	Private     *bool   `json:"private" bson:"private,omitempty"`
+}
+
+// Password change request payload
+type PasswordChange struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,min=8,max=300"`
+}
+
+// Email change request payload
+type EmailChange struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+}
+
+// Account deletion request payload
+type AccountDeletion struct {
+	Password string `json:"password" validate:"required"`
+}
+
+// Roles update request payload
+type UserRoles struct {
+	Roles []string `json:"roles" validate:"required,min=1,dive,oneof=user moderator admin"`
+}
+
+// Second login step request payload. Either the authenticator code or a recovery code is required
+type SecondFactor struct {
+	Challenge    string `json:"challenge" validate:"required"`
+	Code         string `json:"code" validate:"required_without=RecoveryCode"`
+	RecoveryCode string `json:"recovery_code" validate:"required_without=Code"`
+}
+
+// Two factor confirmation request payload
+type TOTPConfirm struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
+
+// Relationship definition. How the user relates to another one, blocks are only shown to the user itself
+type Relationship struct {
+	Follows    bool  `json:"follows"`
+	FollowedBy bool  `json:"followed_by"`
+	Requested  bool  `json:"requested"`
+	Blocking   *bool `json:"blocking,omitempty"`
+	BlockedBy  *bool `json:"blocked_by,omitempty"`
+}
+
+// Suggestion definition. A user the requesting user may want to follow and why
+type Suggestion struct {
+	PublicProfile
+	MutualFollows int     `json:"mutual_follows"`
+	FollowsYou    bool    `json:"follows_you"`
+	RecentPosts   int     `json:"recent_posts"`
+	Score         float64 `json:"score"`
+}
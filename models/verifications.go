@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// EmailVerification definition. The token sent by mail confirms that the user owns Email
+type EmailVerification struct {
+	ID        primitive.ObjectID `json:"_id,omitempty" bson:"_id"`
+	UserID    string             `json:"user_id" bson:"user_id"`
+	Email     string             `json:"email" bson:"email"`
+	TokenHash string             `json:"-" bson:"token_hash"`
+	Used      bool               `json:"used" bson:"used"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	ExpiresAt time.Time          `json:"expires_at" bson:"expires_at"`
+}
@@ -0,0 +1,109 @@
+package ranking
+
+import (
+	"hash/fnv"
+	"math"
+	"sync"
+	"time"
+)
+
+// names of the built-in scorers
+const (
+	Top = "top"
+	Hot = "hot"
+)
+
+// weights of the built-in scorers
+const (
+	commentWeight  = 2.0
+	affinityWeight = 0.5
+	maxAffinity    = 20
+	hotGravity     = 1.8
+	hotAgeOffset   = 2.0
+)
+
+// Signals of a post in the feed of a reader
+type Signals struct {
+	Likes    int
+	Comments int
+	Age      time.Duration
+	// likes and comments of the reader on posts of the author
+	Affinity int
+}
+
+// Scorer interface, implemented by every ranking of the feed. Higher scores go first
+type Scorer interface {
+	Score(s Signals) float64
+}
+
+// ScorerFunc adapts a function to a scorer
+type ScorerFunc func(s Signals) float64
+
+// Score the signals with the function
+func (f ScorerFunc) Score(s Signals) float64 {
+	return f(s)
+}
+
+var (
+	scorersMu sync.RWMutex
+	scorers   = map[string]Scorer{
+		Top: ScorerFunc(top),
+		Hot: ScorerFunc(hot),
+	}
+)
+
+// Register the scorer under the name, replacing the one registered before. Variants of a
+// ranking are registered under their own name and listed in the settings to be tested
+func Register(name string, scorer Scorer) {
+	scorersMu.Lock()
+	defer scorersMu.Unlock()
+	scorers[name] = scorer
+}
+
+// Get the scorer registered under the name
+func Get(name string) (Scorer, bool) {
+	scorersMu.RLock()
+	defer scorersMu.RUnlock()
+	scorer, ok := scorers[name]
+	return scorer, ok
+}
+
+// Pick the variant the user is assigned to. Users are split evenly and always get the same
+// variant while the list does not change. Unknown variants are skipped, fallback is used if none is left
+func Pick(userID string, variants []string, fallback string) string {
+	known := []string{}
+	for _, variant := range variants {
+		if _, ok := Get(variant); ok {
+			known = append(known, variant)
+		}
+	}
+
+	if len(known) == 0 {
+		return fallback
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(userID))
+	return known[h.Sum32()%uint32(len(known))]
+}
+
+// engagement of the post, comments count more than likes
+func engagement(s Signals) float64 {
+	return float64(s.Likes) + commentWeight*float64(s.Comments)
+}
+
+// most engaging posts regardless of their age
+func top(s Signals) float64 {
+	return engagement(s)
+}
+
+// engaging posts of the authors the reader interacts with, decaying with age so new posts can rise
+func hot(s Signals) float64 {
+	affinity := s.Affinity
+	if affinity > maxAffinity {
+		affinity = maxAffinity
+	}
+
+	points := 1 + engagement(s) + affinityWeight*float64(affinity)
+	return points / math.Pow(s.Age.Hours()+hotAgeOffset, hotGravity)
+}
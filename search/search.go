@@ -0,0 +1,130 @@
+package search
+
+import (
+	"contacts/models"
+	"context"
+	"strings"
+	"unicode"
+
+	"github.com/labstack/echo/v4"
+)
+
+// longest search query accepted
+const MaxQueryLength = 200
+
+// Query definition. Terms and quoted phrases are searched in the text, `from:username`
+// keeps the results of one author and `tag:name` the posts with that tag
+type Query struct {
+	Terms   []string
+	Phrases []string
+	From    string
+	Tags    []string
+}
+
+// Engine interface, implemented by every search backend. Results are ranked by relevance
+// and leave out everything the viewer can not see
+type Engine interface {
+	SearchPosts(ctx context.Context, q Query, viewer models.User, page models.PageQuery) ([]PostHit, string, *echo.HTTPError)
+	SearchComments(ctx context.Context, q Query, viewer models.User, page models.PageQuery) ([]CommentHit, string, *echo.HTTPError)
+	SearchUsers(ctx context.Context, q Query, viewer models.User, page models.PageQuery) ([]UserHit, string, *echo.HTTPError)
+}
+
+// PostHit definition. A post found with the part of it that matched
+type PostHit struct {
+	Post    models.Post `json:"post"`
+	Score   float64     `json:"score"`
+	Snippet string      `json:"snippet"`
+}
+
+// CommentHit definition. A comment found with the post it belongs to
+type CommentHit struct {
+	PostID  string         `json:"post_id"`
+	Comment models.Comment `json:"comment"`
+	Score   float64        `json:"score"`
+	Snippet string         `json:"snippet"`
+}
+
+// UserHit definition. A user found with the part of its profile that matched
+type UserHit struct {
+	models.PublicProfile
+	Score   float64 `json:"score"`
+	Snippet string  `json:"snippet"`
+}
+
+// Parse the search query typed by the user. An unclosed quote runs until the end
+func Parse(raw string) Query {
+	var q Query
+
+	runes := []rune(raw)
+	for i := 0; i < len(runes); {
+		switch {
+		case unicode.IsSpace(runes[i]):
+			i++
+		case runes[i] == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+
+			if phrase := strings.Join(strings.Fields(string(runes[i+1:end])), " "); phrase != "" {
+				q.Phrases = append(q.Phrases, phrase)
+			}
+			i = end + 1
+		default:
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && runes[end] != '"' {
+				end++
+			}
+
+			q.addWord(string(runes[i:end]))
+			i = end
+		}
+	}
+
+	return q
+}
+
+// add a word of the query as an operator or a term
+func (q *Query) addWord(word string) {
+	lower := strings.ToLower(word)
+	switch {
+	case strings.HasPrefix(lower, "from:") && len(word) > len("from:"):
+		q.From = strings.TrimPrefix(word[len("from:"):], "@")
+	case strings.HasPrefix(lower, "tag:") && len(word) > len("tag:"):
+		q.Tags = append(q.Tags, word[len("tag:"):])
+	default:
+		q.Terms = append(q.Terms, word)
+	}
+}
+
+// check if the query has nothing to search
+func (q Query) Empty() bool {
+	return !q.HasText() && q.From == "" && len(q.Tags) == 0
+}
+
+// check if the query has terms or phrases to search in the text
+func (q Query) HasText() bool {
+	return len(q.Terms) > 0 || len(q.Phrases) > 0
+}
+
+// Text of the query with the phrases quoted, the syntax of the MongoDB text search
+func (q Query) Text() string {
+	parts := append([]string{}, q.Terms...)
+	for _, phrase := range q.Phrases {
+		parts = append(parts, `"`+phrase+`"`)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// Needles of the query to find in the text: the phrases and the terms that are not excluded
+func (q Query) Needles() []string {
+	needles := append([]string{}, q.Phrases...)
+	for _, term := range q.Terms {
+		if !strings.HasPrefix(term, "-") {
+			needles = append(needles, term)
+		}
+	}
+
+	return needles
+}
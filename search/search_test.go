@@ -0,0 +1,123 @@
+package search
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		raw  string
+		want Query
+	}{
+		{"", Query{}},
+		{"go rust", Query{Terms: []string{"go", "rust"}}},
+		{`go "hello   world"`, Query{Terms: []string{"go"}, Phrases: []string{"hello world"}}},
+		{`go "hello world`, Query{Terms: []string{"go"}, Phrases: []string{"hello world"}}},
+		{`"unclosed`, Query{Phrases: []string{"unclosed"}}},
+		{`"   "`, Query{}},
+		{`a"b c"d`, Query{Terms: []string{"a", "d"}, Phrases: []string{"b c"}}},
+		{"from:alice rust", Query{Terms: []string{"rust"}, From: "alice"}},
+		{"FROM:@Alice", Query{From: "Alice"}},
+		{"tag:go Tag:web", Query{Tags: []string{"go", "web"}}},
+		{"from: tag:", Query{Terms: []string{"from:", "tag:"}}},
+		{"go -java", Query{Terms: []string{"go", "-java"}}},
+	}
+
+	for _, c := range cases {
+		if got := Parse(c.raw); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Parse(%q): got %+v, want %+v", c.raw, got, c.want)
+		}
+	}
+}
+
+func TestQueryExclusion(t *testing.T) {
+	q := Parse(`go -java "hello world"`)
+
+	if got, want := q.Needles(), []string{"hello world", "go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Needles: got %q, want %q", got, want)
+	}
+
+	if got, want := q.Text(), `go -java "hello world"`; got != want {
+		t.Errorf("Text: got %q, want %q", got, want)
+	}
+
+	if got := Parse("-java").Needles(); len(got) != 0 {
+		t.Errorf("Needles of an excluded term: got %q, want none", got)
+	}
+}
+
+func TestQueryEmpty(t *testing.T) {
+	cases := []struct {
+		raw   string
+		empty bool
+		text  bool
+	}{
+		{"", true, false},
+		{`""`, true, false},
+		{"from:alice", false, false},
+		{"tag:go", false, false},
+		{"go", false, true},
+		{`"go"`, false, true},
+	}
+
+	for _, c := range cases {
+		q := Parse(c.raw)
+		if q.Empty() != c.empty || q.HasText() != c.text {
+			t.Errorf("%q: got empty %v and text %v, want %v and %v", c.raw, q.Empty(), q.HasText(), c.empty, c.text)
+		}
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	cases := []struct {
+		name  string
+		query string
+		text  string
+		want  string
+		found bool
+	}{
+		{"no match", "go", "<b>rust</b> & more", "&lt;b&gt;rust&lt;/b&gt; &amp; more", false},
+		{"match escaped around", "script", "<b>script</b> & more", "&lt;b&gt;<mark>script</mark>&lt;/b&gt; &amp; more", true},
+		{"match escaped inside", `"a<b"`, "x a<b y", "x <mark>a&lt;b</mark> y", true},
+		{"case insensitive", "go", "Go & GO", "<mark>Go</mark> &amp; <mark>GO</mark>", true},
+		{"longest needle", `go "go fast"`, "go fast", "<mark>go fast</mark>", true},
+		{"excluded term", "-go", "go", "go", false},
+		{"spaces collapsed", "go", "a\n\n  go", "a <mark>go</mark>", true},
+	}
+
+	for _, c := range cases {
+		got, found := Snippet(Parse(c.query), c.text)
+		if got != c.want || found != c.found {
+			t.Errorf("%s: got %q %v, want %q %v", c.name, got, found, c.want, c.found)
+		}
+	}
+}
+
+func TestSnippetCut(t *testing.T) {
+	text := strings.Repeat("x", 70) + "&needle"
+	want := "…" + strings.Repeat("x", 59) + "&amp;<mark>needle</mark>"
+	if got, _ := Snippet(Parse("needle"), text); got != want {
+		t.Errorf("context: got %q, want %q", got, want)
+	}
+
+	// a match over the end of the snippet is marked up to the cut
+	text = "needle " + strings.Repeat("y", 150) + " needle <b>"
+	want = "<mark>needle</mark> " + strings.Repeat("y", 150) + " <mark>ne</mark>…"
+	if got, _ := Snippet(Parse("needle"), text); got != want {
+		t.Errorf("end: got %q, want %q", got, want)
+	}
+}
+
+func TestBestSnippet(t *testing.T) {
+	q := Parse("go")
+
+	if got, want := BestSnippet(q, "", "rust & c", "<i>go</i>"), "&lt;i&gt;<mark>go</mark>&lt;/i&gt;"; got != want {
+		t.Errorf("match: got %q, want %q", got, want)
+	}
+
+	if got, want := BestSnippet(q, "", "rust & c", "java"), "rust &amp; c"; got != want {
+		t.Errorf("no match: got %q, want %q", got, want)
+	}
+}
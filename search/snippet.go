@@ -0,0 +1,120 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// length of the snippets and how much text is kept before the first match, in characters
+const (
+	snippetLength  = 160
+	snippetContext = 60
+)
+
+// Snippet of the first of the texts where a needle of the query is found, or of the first
+// non empty text if none matches
+func BestSnippet(q Query, texts ...string) string {
+	first := ""
+	for _, text := range texts {
+		if text == "" {
+			continue
+		}
+
+		if first == "" {
+			first = text
+		}
+
+		if snippet, found := Snippet(q, text); found {
+			return snippet
+		}
+	}
+
+	snippet, _ := Snippet(q, first)
+	return snippet
+}
+
+// Cut the text around the first needle of the query found, case insensitive, and wrap the
+// needles in <mark> tags. The rest of the text is html escaped. Return whether a needle was found
+func Snippet(q Query, text string) (string, bool) {
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	needles := [][]rune{}
+	for _, needle := range q.Needles() {
+		needles = append(needles, []rune(strings.ToLower(needle)))
+	}
+
+	// matches as start and end positions, without overlaps
+	matches := [][2]int{}
+	for i := 0; i < len(lower); {
+		length := longestNeedleAt(lower, i, needles)
+		if length == 0 {
+			i++
+			continue
+		}
+
+		matches = append(matches, [2]int{i, i + length})
+		i += length
+	}
+
+	start := 0
+	if len(matches) > 0 && matches[0][0] > snippetContext {
+		start = matches[0][0] - snippetContext
+	}
+
+	end := start + snippetLength
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+
+	pos := start
+	for _, match := range matches {
+		if match[1] <= start || match[0] >= end {
+			continue
+		}
+
+		matchStart, matchEnd := match[0], match[1]
+		if matchStart < pos {
+			matchStart = pos
+		}
+		if matchEnd > end {
+			matchEnd = end
+		}
+
+		b.WriteString(html.EscapeString(string(runes[pos:matchStart])))
+		b.WriteString("<mark>" + html.EscapeString(string(runes[matchStart:matchEnd])) + "</mark>")
+		pos = matchEnd
+	}
+
+	b.WriteString(html.EscapeString(string(runes[pos:end])))
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+
+	return b.String(), len(matches) > 0
+}
+
+// length of the longest needle found at the position, 0 if none
+func longestNeedleAt(text []rune, pos int, needles [][]rune) int {
+	longest := 0
+	for _, needle := range needles {
+		if len(needle) <= longest || pos+len(needle) > len(text) {
+			continue
+		}
+
+		if string(text[pos:pos+len(needle)]) == string(needle) {
+			longest = len(needle)
+		}
+	}
+
+	return longest
+}